@@ -0,0 +1,153 @@
+package main
+
+// Combine the results of several workers taking part in the same benchmark
+// into a single PerfData. Counts, rates and errors are summed, times are
+// averaged, weighted by the number of connections (or replies) each worker
+// made, and the extremes are kept for minimums and maximums. Fields that
+// cannot be combined meaningfully, such as the raw output, are left empty.
+// Warmup results are not included.
+func AggregatePerfData(all []*PerfData) *PerfData {
+	data := make([]*PerfData, 0, len(all))
+	for _, perfdata := range all {
+		if !perfdata.Warmup {
+			data = append(data, perfdata)
+		}
+	}
+
+	agg := new(PerfData)
+	if len(data) == 0 {
+		return agg
+	}
+
+	first := data[0]
+	agg.BenchmarkId = first.BenchmarkId
+	agg.BenchmarkDate = first.BenchmarkDate
+	agg.Phase = first.Phase
+	agg.Target = first.Target
+	agg.ArgHost = first.ArgHost
+	agg.ArgPort = first.ArgPort
+	agg.ArgURL = first.ArgURL
+	agg.ArgRequestsPerConnection = first.ArgRequestsPerConnection
+	agg.ArgDuration = first.ArgDuration
+	agg.TotalOfferedLoad = first.TotalOfferedLoad
+	agg.WorkerLabel = "all"
+	agg.WorkerGroup = first.WorkerGroup
+	agg.ConnectionTimeMin = first.ConnectionTimeMin
+	agg.RepliesPerSecMin = first.RepliesPerSecMin
+	agg.NetIOUnit = first.NetIOUnit
+
+	var connWeight, replyWeight float64
+
+	for _, d := range data {
+		if d.WorkerGroup != agg.WorkerGroup {
+			agg.WorkerGroup = ""
+		}
+
+		agg.ArgNumConnections += d.ArgNumConnections
+		agg.ArgConnectionRate += d.ArgConnectionRate
+		agg.ArgConcurrency += d.ArgConcurrency
+
+		if d.WorkerElapsed > agg.WorkerElapsed {
+			agg.WorkerElapsed = d.WorkerElapsed
+		}
+		if d.ConnectionBurstLength > agg.ConnectionBurstLength {
+			agg.ConnectionBurstLength = d.ConnectionBurstLength
+		}
+		if d.TestDuration > agg.TestDuration {
+			agg.TestDuration = d.TestDuration
+		}
+		if d.ConnectionTimeMin < agg.ConnectionTimeMin {
+			agg.ConnectionTimeMin = d.ConnectionTimeMin
+		}
+		if d.ConnectionTimeMax > agg.ConnectionTimeMax {
+			agg.ConnectionTimeMax = d.ConnectionTimeMax
+		}
+		if d.RepliesPerSecMin < agg.RepliesPerSecMin {
+			agg.RepliesPerSecMin = d.RepliesPerSecMin
+		}
+
+		agg.TotalConnections += d.TotalConnections
+		agg.TotalRequests += d.TotalRequests
+		agg.TotalReplies += d.TotalReplies
+		agg.ConnectionsPerSecond += d.ConnectionsPerSecond
+		agg.ConcurrentConnections += d.ConcurrentConnections
+		agg.RequestsPerSecond += d.RequestsPerSecond
+		agg.RepliesPerSecAvg += d.RepliesPerSecAvg
+		agg.RepliesPerSecMax += d.RepliesPerSecMax
+		agg.RepliesPerSecNumSamples += d.RepliesPerSecNumSamples
+
+		agg.ReplyStatus_1xx += d.ReplyStatus_1xx
+		agg.ReplyStatus_2xx += d.ReplyStatus_2xx
+		agg.ReplyStatus_3xx += d.ReplyStatus_3xx
+		agg.ReplyStatus_4xx += d.ReplyStatus_4xx
+		agg.ReplyStatus_5xx += d.ReplyStatus_5xx
+
+		agg.CpuTimeUser += d.CpuTimeUser
+		agg.CpuTimeSystem += d.CpuTimeSystem
+
+		agg.ErrTotal += d.ErrTotal
+		agg.ErrClientTimeout += d.ErrClientTimeout
+		agg.ErrSocketTimeout += d.ErrSocketTimeout
+		agg.ErrConnectionRefused += d.ErrConnectionRefused
+		agg.ErrConnectionReset += d.ErrConnectionReset
+		agg.ErrFdUnavail += d.ErrFdUnavail
+		agg.ErrAddRunAvail += d.ErrAddRunAvail
+		agg.ErrFtabFull += d.ErrFtabFull
+		agg.ErrOther += d.ErrOther
+
+		if d.NetIOUnit == agg.NetIOUnit {
+			agg.NetIOValue += d.NetIOValue
+		}
+
+		// Weighted sums, divided through below
+		agg.ConnectionTimeAvg += d.ConnectionTimeAvg * d.TotalConnections
+		agg.ConnectionTimeMedian += d.ConnectionTimeMedian * d.TotalConnections
+		agg.ConnectionTimeStddev += d.ConnectionTimeStddev * d.TotalConnections
+		agg.ConnectionTimeConnect += d.ConnectionTimeConnect * d.TotalConnections
+		agg.RepliesPerConnection += d.RepliesPerConnection * d.TotalConnections
+		agg.RequestSize += d.RequestSize * d.TotalConnections
+		agg.CpuPercUser += d.CpuPercUser * d.TotalConnections
+		agg.CpuPercSystem += d.CpuPercSystem * d.TotalConnections
+		agg.CpuPercTotal += d.CpuPercTotal * d.TotalConnections
+		connWeight += d.TotalConnections
+
+		agg.ReplyTimeResponse += d.ReplyTimeResponse * d.TotalReplies
+		agg.ReplyTimeTransfer += d.ReplyTimeTransfer * d.TotalReplies
+		agg.ReplySizeHeader += d.ReplySizeHeader * d.TotalReplies
+		agg.ReplySizeContent += d.ReplySizeContent * d.TotalReplies
+		agg.ReplySizeFooter += d.ReplySizeFooter * d.TotalReplies
+		agg.ReplySizeTotal += d.ReplySizeTotal * d.TotalReplies
+		replyWeight += d.TotalReplies
+	}
+
+	if connWeight > 0 {
+		agg.ConnectionTimeAvg /= connWeight
+		agg.ConnectionTimeMedian /= connWeight
+		agg.ConnectionTimeStddev /= connWeight
+		agg.ConnectionTimeConnect /= connWeight
+		agg.RepliesPerConnection /= connWeight
+		agg.RequestSize /= connWeight
+		agg.CpuPercUser /= connWeight
+		agg.CpuPercSystem /= connWeight
+		agg.CpuPercTotal /= connWeight
+	}
+
+	if replyWeight > 0 {
+		agg.ReplyTimeResponse /= replyWeight
+		agg.ReplyTimeTransfer /= replyWeight
+		agg.ReplySizeHeader /= replyWeight
+		agg.ReplySizeContent /= replyWeight
+		agg.ReplySizeFooter /= replyWeight
+		agg.ReplySizeTotal /= replyWeight
+	}
+
+	// The per-connection and per-request times follow from the rates
+	if agg.ConnectionsPerSecond > 0 {
+		agg.MsPerConnection = 1000 / agg.ConnectionsPerSecond
+	}
+	if agg.RequestsPerSecond > 0 {
+		agg.MsPerRequest = 1000 / agg.RequestsPerSecond
+	}
+
+	return agg
+}
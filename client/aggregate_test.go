@@ -0,0 +1,84 @@
+package main
+
+import "math"
+import "testing"
+
+var aggregateTests = []struct {
+	name                         string
+	data                         []*PerfData
+	rate                         int
+	connsPerSec, connAvg         float64
+	connMin, connMax             float64
+	response, errors, repliesMin float64
+	group                        string
+}{
+	{
+		"weighted by connections and replies",
+		[]*PerfData{
+			&PerfData{ArgConnectionRate: 10, WorkerGroup: "a", TotalConnections: 100, TotalReplies: 100,
+				ConnectionsPerSecond: 10, ConnectionTimeAvg: 10, ConnectionTimeMin: 2, ConnectionTimeMax: 50,
+				ReplyTimeResponse: 4, ErrTotal: 1, RepliesPerSecMin: 5},
+			&PerfData{ArgConnectionRate: 30, WorkerGroup: "a", TotalConnections: 300, TotalReplies: 300,
+				ConnectionsPerSecond: 30, ConnectionTimeAvg: 20, ConnectionTimeMin: 1, ConnectionTimeMax: 40,
+				ReplyTimeResponse: 8, ErrTotal: 2, RepliesPerSecMin: 3},
+		},
+		40, 40, 17.5, 1, 50, 7, 3, 3, "a",
+	},
+	{
+		"warmup left out",
+		[]*PerfData{
+			&PerfData{Warmup: true, ArgConnectionRate: 500, WorkerGroup: "b", TotalConnections: 5000, TotalReplies: 5000,
+				ConnectionsPerSecond: 500, ConnectionTimeAvg: 90, ConnectionTimeMin: 0.5, ConnectionTimeMax: 900,
+				ReplyTimeResponse: 90, ErrTotal: 50, RepliesPerSecMin: 1},
+			&PerfData{ArgConnectionRate: 10, WorkerGroup: "a", TotalConnections: 100, TotalReplies: 100,
+				ConnectionsPerSecond: 10, ConnectionTimeAvg: 10, ConnectionTimeMin: 2, ConnectionTimeMax: 50,
+				ReplyTimeResponse: 4, ErrTotal: 1, RepliesPerSecMin: 5},
+		},
+		10, 10, 10, 2, 50, 4, 1, 5, "a",
+	},
+	{
+		"workers of different groups",
+		[]*PerfData{
+			&PerfData{ArgConnectionRate: 10, WorkerGroup: "a", TotalConnections: 100, ConnectionsPerSecond: 10,
+				ConnectionTimeAvg: 10, ConnectionTimeMin: 2, ConnectionTimeMax: 50},
+			&PerfData{ArgConnectionRate: 10, WorkerGroup: "b", TotalConnections: 100, ConnectionsPerSecond: 10,
+				ConnectionTimeAvg: 30, ConnectionTimeMin: 3, ConnectionTimeMax: 60},
+		},
+		20, 20, 20, 2, 60, 0, 0, 0, "",
+	},
+	{
+		"no results",
+		[]*PerfData{},
+		0, 0, 0, 0, 0, 0, 0, 0, "",
+	},
+}
+
+func TestAggregatePerfData(t *testing.T) {
+	for _, test := range aggregateTests {
+		agg := AggregatePerfData(test.data)
+
+		if agg.OfferedLoad() != test.rate {
+			t.Errorf("%s: expected a rate of %d, got %d", test.name, test.rate, agg.OfferedLoad())
+		}
+		if agg.WorkerGroup != test.group {
+			t.Errorf("%s: expected group '%s', got '%s'", test.name, test.group, agg.WorkerGroup)
+		}
+
+		got := []float64{agg.ConnectionsPerSecond, agg.ConnectionTimeAvg, agg.ConnectionTimeMin,
+			agg.ConnectionTimeMax, agg.ReplyTimeResponse, agg.ErrTotal, agg.RepliesPerSecMin}
+		expected := []float64{test.connsPerSec, test.connAvg, test.connMin, test.connMax,
+			test.response, test.errors, test.repliesMin}
+		names := []string{"ConnectionsPerSecond", "ConnectionTimeAvg", "ConnectionTimeMin",
+			"ConnectionTimeMax", "ReplyTimeResponse", "ErrTotal", "RepliesPerSecMin"}
+
+		for idx := range got {
+			if math.Abs(got[idx]-expected[idx]) > 1e-9 {
+				t.Errorf("%s: expected %s of %g, got %g", test.name, names[idx], expected[idx], got[idx])
+			}
+		}
+
+		if test.connsPerSec > 0 && agg.MsPerConnection != 1000/test.connsPerSec {
+			t.Errorf("%s: expected %g ms per connection, got %g", test.name, 1000/test.connsPerSec, agg.MsPerConnection)
+		}
+	}
+}
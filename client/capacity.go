@@ -0,0 +1,202 @@
+package main
+
+import "io/ioutil"
+import "json"
+import "log"
+import "os"
+import "sort"
+
+// A single step of a stress test, combined over its workers and trials
+type CapacityPoint struct {
+	Rate       int     // The offered connection rate, or closed-loop clients
+	Throughput float64 // The achieved connections per second
+	Latency    float64 // The reply time in ms
+	Errors     float64 // The number of errors
+}
+
+type capacityPoints []CapacityPoint
+
+func (p capacityPoints) Len() int           { return len(p) }
+func (p capacityPoints) Less(i, j int) bool { return p[i].Rate < p[j].Rate }
+func (p capacityPoints) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// The capacity of a server, as found by a stress test. Rates are zero when
+// no step met the criteria.
+type Capacity struct {
+	Phase  string
+	Target string // The label of the target, when there are several
+
+	MaxErrorFreeRate int     // The highest rate with no errors
+	MaxLatency       float64 // The latency criteria, in ms
+	MaxLatencyRate   int     // The highest rate within the latency criteria
+
+	// The point at which the reply time starts rising superlinearly
+	KneeRate    int
+	KneeLatency float64
+
+	PeakThroughput     float64
+	PeakThroughputRate int
+
+	Points []CapacityPoint
+}
+
+// Reduce the results of a stress test to one point per step, sorted by the
+// offered rate. The trial statistics are used where available, so repeated
+// trials are averaged rather than summed. Warmup results are ignored, and
+// when a rate is revisited (e.g. by a recovery search) the first visit is
+// kept.
+func CapacityPoints(data []*PerfData) []CapacityPoint {
+	steps := make(map[int][]*PerfData)
+	order := make([]int, 0)
+
+	for _, perfdata := range data {
+		if perfdata.Warmup {
+			continue
+		}
+		if _, ok := steps[perfdata.Step]; !ok {
+			order = append(order, perfdata.Step)
+		}
+		steps[perfdata.Step] = append(steps[perfdata.Step], perfdata)
+	}
+
+	seen := make(map[int]bool)
+	points := make([]CapacityPoint, 0, len(order))
+
+	for _, step := range order {
+		rows := steps[step]
+
+		// Older results only have the load of each worker, which is split
+		// over the workers of each trial
+		rate := rows[0].TotalOfferedLoad
+		if rate == 0 {
+			trials := make(map[int]bool)
+			for _, perfdata := range rows {
+				trials[perfdata.Trial] = true
+				rate += perfdata.OfferedLoad()
+			}
+			rate = rate / len(trials)
+		}
+
+		if seen[rate] {
+			continue
+		}
+		seen[rate] = true
+
+		first := rows[0]
+		point := CapacityPoint{rate, first.ConnectionsPerSecondMean, first.ReplyTimeResponseMean, first.ErrTotalMean}
+
+		// Results without trial statistics are simply aggregated
+		if first.Trial == 0 {
+			agg := AggregatePerfData(rows)
+			point = CapacityPoint{rate, agg.ConnectionsPerSecond, agg.ReplyTimeResponse, agg.ErrTotal}
+		}
+
+		points = append(points, point)
+	}
+
+	sort.Sort(capacityPoints(points))
+	return points
+}
+
+// Summarise the capacity of a server from the points of a stress test. The
+// latency criteria is ignored if it is zero.
+func SummarizeCapacity(points []CapacityPoint, maxLatency float64) *Capacity {
+	capacity := &Capacity{MaxLatency: maxLatency, Points: points}
+
+	for _, point := range points {
+		if point.Errors == 0 && point.Rate > capacity.MaxErrorFreeRate {
+			capacity.MaxErrorFreeRate = point.Rate
+		}
+		if maxLatency > 0 && point.Latency <= maxLatency && point.Rate > capacity.MaxLatencyRate {
+			capacity.MaxLatencyRate = point.Rate
+		}
+		if point.Throughput > capacity.PeakThroughput {
+			capacity.PeakThroughput = point.Throughput
+			capacity.PeakThroughputRate = point.Rate
+		}
+	}
+
+	if knee := FindKnee(points); knee >= 0 {
+		capacity.KneeRate = points[knee].Rate
+		capacity.KneeLatency = points[knee].Latency
+	}
+
+	return capacity
+}
+
+// Find the knee of the latency curve, i.e. the point after which latency
+// starts rising superlinearly with the rate. Both axes are normalised to
+// [0, 1], and the knee is the point furthest below the straight line from
+// the first point to the last. Returns the index of the knee, or -1 if the
+// curve does not bend upwards.
+func FindKnee(points []CapacityPoint) int {
+	if len(points) < 3 {
+		return -1
+	}
+
+	first := points[0]
+	last := points[len(points)-1]
+
+	xrange := float64(last.Rate - first.Rate)
+	yrange := last.Latency - first.Latency
+	if xrange <= 0 || yrange <= 0 {
+		return -1
+	}
+
+	knee := -1
+	best := 0.0
+
+	for idx, point := range points {
+		x := float64(point.Rate-first.Rate) / xrange
+		y := (point.Latency - first.Latency) / yrange
+
+		if distance := x - y; distance > best {
+			best = distance
+			knee = idx
+		}
+	}
+
+	return knee
+}
+
+// The capacity summaries of every stress test run so far
+var capacitySummaries []*Capacity
+
+// Log a summary of the capacity found by a stress test, and write it to the
+// -summary file if one was given. The file lists the summary of every stress
+// test in the run.
+func ReportCapacity(data []*PerfData, phase *Phase) *Capacity {
+	capacity := SummarizeCapacity(CapacityPoints(data), *maxLatency)
+	capacity.Phase = phase.Name
+	capacity.Target = phase.target
+
+	log.Printf("Capacity summary for phase %s:", phase.Title())
+	log.Printf("  Highest rate with no errors: %d", capacity.MaxErrorFreeRate)
+	if capacity.MaxLatency > 0 {
+		log.Printf("  Highest rate with reply time within %.1f ms: %d", capacity.MaxLatency, capacity.MaxLatencyRate)
+	}
+	if capacity.KneeRate > 0 {
+		log.Printf("  Knee of the latency curve: rate %d at %.1f ms", capacity.KneeRate, capacity.KneeLatency)
+	} else {
+		log.Printf("  Knee of the latency curve: not found")
+	}
+	log.Printf("  Peak throughput: %.1f conn/s at rate %d", capacity.PeakThroughput, capacity.PeakThroughputRate)
+
+	capacitySummaries = append(capacitySummaries, capacity)
+
+	if *summaryFile != "" {
+		if err := writeCapacity(*summaryFile, capacitySummaries); err != nil {
+			log.Printf("Could not write the capacity summary: %s", err.String())
+		}
+	}
+
+	return capacity
+}
+
+func writeCapacity(filename string, summaries []*Capacity) os.Error {
+	contents, err := json.MarshalIndent(summaries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, contents, 0644)
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+var testPoints = []CapacityPoint{
+	{100, 100, 1.0, 0},
+	{200, 200, 1.1, 0},
+	{300, 300, 1.3, 0},
+	{400, 390, 2.0, 0},
+	{500, 420, 6.0, 20},
+	{600, 380, 20.0, 900},
+}
+
+func TestFindKnee(t *testing.T) {
+	knee := FindKnee(testPoints)
+	if knee != 3 {
+		t.Errorf("Expected the knee at rate 400, got index %d", knee)
+	}
+
+	if FindKnee(testPoints[:2]) != -1 {
+		t.Errorf("Expected no knee with only two points")
+	}
+
+	flat := []CapacityPoint{{100, 100, 1, 0}, {200, 200, 1, 0}, {300, 300, 1, 0}}
+	if FindKnee(flat) != -1 {
+		t.Errorf("Expected no knee with a flat latency curve")
+	}
+}
+
+func TestSummarizeCapacity(t *testing.T) {
+	capacity := SummarizeCapacity(testPoints, 5)
+
+	if capacity.MaxErrorFreeRate != 400 {
+		t.Errorf("Expected the highest error free rate to be 400, got %d", capacity.MaxErrorFreeRate)
+	}
+	if capacity.MaxLatencyRate != 400 {
+		t.Errorf("Expected the highest rate within 5 ms to be 400, got %d", capacity.MaxLatencyRate)
+	}
+	if capacity.PeakThroughput != 420 || capacity.PeakThroughputRate != 500 {
+		t.Errorf("Expected a peak throughput of 420 at rate 500, got %f at %d",
+			capacity.PeakThroughput, capacity.PeakThroughputRate)
+	}
+}
+
+func TestCapacityPointsTotalLoad(t *testing.T) {
+	data := make([]*PerfData, 0)
+	for _, label := range []string{"w1", "w2", "w3"} {
+		data = append(data, &PerfData{Step: 1, ArgConnectionRate: 33, TotalOfferedLoad: 100,
+			WorkerLabel: label, ConnectionsPerSecond: 33})
+	}
+	// Written before the total was recorded
+	data = append(data, &PerfData{Step: 2, ArgConnectionRate: 100, WorkerLabel: "w1", ConnectionsPerSecond: 99},
+		&PerfData{Step: 2, ArgConnectionRate: 100, WorkerLabel: "w2", ConnectionsPerSecond: 99})
+
+	points := CapacityPoints(data)
+	if len(points) != 2 || points[0].Rate != 100 || points[1].Rate != 200 {
+		t.Fatalf("Expected points at rates 100 and 200, got %v", points)
+	}
+	if points[0].Throughput != 99 {
+		t.Errorf("Expected the workers' throughput summed, got %f", points[0].Throughput)
+	}
+
+	benchmarks := BenchmarkPoints(data[:3])
+	if len(benchmarks) != 1 || benchmarks[0].Rate != 100 {
+		t.Errorf("Expected the benchmark at rate 100, got %v", benchmarks)
+	}
+}
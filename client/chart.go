@@ -0,0 +1,187 @@
+package main
+
+import "bytes"
+import "fmt"
+import "math"
+
+// The layout of each chart, in pixels
+const (
+	chartWidth  = 680
+	chartHeight = 320
+	chartLeft   = 70
+	chartRight  = 150
+	chartTop    = 30
+	chartBottom = 45
+	chartTicks  = 5
+)
+
+var chartColours = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// A named series of points on a chart. For a bar chart, the X values are
+// the categories and must be the same for every series.
+type ChartSeries struct {
+	Name string
+	X, Y []float64
+}
+
+// A line or stacked bar chart, drawn as an inline SVG image
+type Chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Series []*ChartSeries
+
+	Stacked bool // Draw stacked bars at each X rather than lines
+}
+
+func (c *Chart) Add(name string, x []float64, y []float64) {
+	c.Series = append(c.Series, &ChartSeries{name, x, y})
+}
+
+// Round a value up to 1, 2 or 5 times a power of ten, to give the top of a
+// readable axis. Values that aren't positive give an axis of 0 to 1.
+func niceCeil(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+
+	exp := math.Pow(10, math.Floor(math.Log10(value)))
+	switch fraction := value / exp; {
+	case fraction <= 1:
+		return exp
+	case fraction <= 2:
+		return 2 * exp
+	case fraction <= 5:
+		return 5 * exp
+	}
+	return 10 * exp
+}
+
+// Format an axis label without trailing zeros
+func axisLabel(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
+
+// The largest X and Y values on the chart. For a stacked chart, Y is the
+// height of the tallest stack.
+func (c *Chart) extent() (float64, float64) {
+	xmax, ymax := 0.0, 0.0
+	stacks := make(map[int]float64)
+
+	for _, series := range c.Series {
+		for idx := range series.X {
+			xmax = math.Fmax(xmax, series.X[idx])
+			if c.Stacked {
+				stacks[idx] += series.Y[idx]
+				ymax = math.Fmax(ymax, stacks[idx])
+			} else {
+				ymax = math.Fmax(ymax, series.Y[idx])
+			}
+		}
+	}
+
+	return xmax, ymax
+}
+
+// Render the chart as an SVG element
+func (c *Chart) SVG() string {
+	buf := new(bytes.Buffer)
+	plotWidth := float64(chartWidth - chartLeft - chartRight)
+	plotHeight := float64(chartHeight - chartTop - chartBottom)
+	bottom := float64(chartTop) + plotHeight
+
+	fmt.Fprintf(buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"11\">\n",
+		chartWidth, chartHeight)
+	fmt.Fprintf(buf, "<text x=\"%d\" y=\"18\" font-size=\"14\" font-weight=\"bold\">%s</text>\n", chartLeft, xmlEscape(c.Title))
+
+	points := 0
+	for _, series := range c.Series {
+		points += len(series.X)
+	}
+	if points == 0 {
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\">No data</text>\n</svg>\n", chartLeft, chartTop+20)
+		return buf.String()
+	}
+
+	xmax, ymax := c.extent()
+	xmax, ymax = niceCeil(xmax), niceCeil(ymax)
+
+	// The Y axis, with a grid line at each tick
+	for tick := 0; tick <= chartTicks; tick++ {
+		value := ymax * float64(tick) / chartTicks
+		y := bottom - plotHeight*float64(tick)/chartTicks
+		fmt.Fprintf(buf, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#ddd\"/>\n",
+			chartLeft, y, float64(chartLeft)+plotWidth, y)
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%s</text>\n", chartLeft-5, y+4, axisLabel(value))
+	}
+
+	// The X axis, labelled by category for bars or by value for lines
+	categories := c.Series[0].X
+	slot := plotWidth / float64(len(categories))
+	xpos := func(idx int, value float64) float64 {
+		if c.Stacked {
+			return float64(chartLeft) + slot*(float64(idx)+0.5)
+		}
+		return float64(chartLeft) + plotWidth*value/xmax
+	}
+
+	if c.Stacked {
+		for idx, value := range categories {
+			fmt.Fprintf(buf, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n",
+				xpos(idx, value), bottom+15, axisLabel(value))
+		}
+	} else {
+		for tick := 0; tick <= chartTicks; tick++ {
+			value := xmax * float64(tick) / chartTicks
+			fmt.Fprintf(buf, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n",
+				xpos(0, value), bottom+15, axisLabel(value))
+		}
+	}
+
+	fmt.Fprintf(buf, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#000\"/>\n",
+		chartLeft, bottom, float64(chartLeft)+plotWidth, bottom)
+	fmt.Fprintf(buf, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%.1f\" stroke=\"#000\"/>\n",
+		chartLeft, chartTop, chartLeft, bottom)
+
+	fmt.Fprintf(buf, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\">%s</text>\n",
+		float64(chartLeft)+plotWidth/2, chartHeight-8, xmlEscape(c.XLabel))
+	fmt.Fprintf(buf, "<text x=\"15\" y=\"%.1f\" text-anchor=\"middle\" transform=\"rotate(-90 15 %.1f)\">%s</text>\n",
+		float64(chartTop)+plotHeight/2, float64(chartTop)+plotHeight/2, xmlEscape(c.YLabel))
+
+	// The series themselves
+	stacks := make([]float64, len(categories))
+	for sidx, series := range c.Series {
+		colour := chartColours[sidx%len(chartColours)]
+
+		if c.Stacked {
+			width := slot * 0.6
+			for idx := range series.X {
+				height := plotHeight * series.Y[idx] / ymax
+				top := bottom - plotHeight*stacks[idx]/ymax - height
+				stacks[idx] += series.Y[idx]
+				if height > 0 {
+					fmt.Fprintf(buf, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"><title>%s: %g</title></rect>\n",
+						xpos(idx, 0)-width/2, top, width, height, colour, xmlEscape(series.Name), series.Y[idx])
+				}
+			}
+		} else {
+			path := new(bytes.Buffer)
+			for idx := range series.X {
+				x := xpos(idx, series.X[idx])
+				y := bottom - plotHeight*series.Y[idx]/ymax
+				fmt.Fprintf(path, "%.1f,%.1f ", x, y)
+				fmt.Fprintf(buf, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"3\" fill=\"%s\"><title>%s: %g, %g</title></circle>\n",
+					x, y, colour, xmlEscape(series.Name), series.X[idx], series.Y[idx])
+			}
+			fmt.Fprintf(buf, "<polyline points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"2\"/>\n", path.String(), colour)
+		}
+
+		// The legend
+		y := chartTop + 10 + 18*sidx
+		fmt.Fprintf(buf, "<rect x=\"%d\" y=\"%d\" width=\"12\" height=\"12\" fill=\"%s\"/>\n", chartWidth-chartRight+15, y-10, colour)
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\">%s</text>\n", chartWidth-chartRight+32, y, xmlEscape(series.Name))
+	}
+
+	fmt.Fprintf(buf, "</svg>\n")
+	return buf.String()
+}
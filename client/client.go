@@ -24,23 +24,34 @@ func RunDistributedBenchmark(workers []*Worker, args *Args) ([]*PerfData, bool)
 	log.Printf("Distributing benchmark over %d clients", numWorkers)
 	log.Printf("Arguments: %#v", args)
 
-	for _, worker := range workers {
-		wargs := &Args{
-			args.Host,
-			args.Port,
-			args.URL,
-			args.NumConnections / numWorkers,
-			args.ConnectionRate / numWorkers,
-			args.RequestsPerConnection,
-			args.Duration,
+	// Each worker takes a share of the connections and rate in proportion to
+	// its weight, and any group workload overrides the target.
+	shares := WorkerShares(workers)
+	coordinator.SetBenchmark(args)
+
+	// The shares of the load are rounded down, so the load of the whole
+	// benchmark is recorded with each worker's results
+	load := args.ConnectionRate
+	if args.Concurrency > 0 {
+		load = args.Concurrency
+	}
+
+	clients := 0
+	for idx, worker := range workers {
+		wargs := args.Divide(shares[idx])
+		if worker.workload != nil {
+			worker.workload.Apply(wargs)
 		}
+		clients += wargs.Concurrency
 
 		result := new(Result)
 
+		coordinator.WorkerStarted(worker)
 		call := worker.client.Go("HTTPerf.Benchmark", wargs, &result, nil)
 
 		if call.Error != nil {
 			log.Printf("[%s] Failed to open connection: %s", worker.id, call.Error)
+			coordinator.WorkerFinished(worker, call.Error.String(), true)
 			worker.args = wargs
 			worker.result = nil
 			worker.call = nil
@@ -50,198 +61,536 @@ func RunDistributedBenchmark(workers []*Worker, args *Args) ([]*PerfData, bool)
 			worker.result = result
 			worker.call = call
 			worker.date = time.Seconds()
+			worker.started = time.Nanoseconds()
+			worker.finished = 0
+			worker.exited = 0
+		}
+	}
+
+	// Every worker runs at least one client, and the shares are rounded
+	// down, so the total may not be what was asked for
+	if args.Concurrency > 0 && clients != args.Concurrency {
+		log.Printf("Warning: a concurrency of %d was split over %d workers as %d clients in total",
+			args.Concurrency, numWorkers, clients)
+	}
+
+	// Wait for each of the pending calls in its own goroutine, and fan the
+	// completions back in so that results are collected in the order the
+	// workers finish, rather than the order they were started.
+	done := make(chan *Worker)
+	pending := 0
+
+	for _, worker := range workers {
+		if worker.call != nil {
+			pending++
+			go func(worker *Worker) {
+				<-worker.call.Done
+				done <- worker
+			}(worker)
 		}
 	}
 
 	// Collect the PerfData into a slice
 	results := make([]*PerfData, 0, len(workers))
-	success := true
+	finished := make([]*Worker, 0, len(workers))
+	urlCounts := make([]URLCount, 0)
+	success := pending == numWorkers
 
-	for _, worker := range workers {
-		if worker.call == nil {
-			// This call was not successful
-			success = false
-		} else {
-			call := <-worker.call.Done
-			log.Printf("[%s] Got results", worker.id)
+	ticker := time.NewTicker(stragglerInterval)
+	defer ticker.Stop()
+
+	for pending > 0 {
+		select {
+		case worker := <-done:
+			pending--
+			worker.finished = time.Nanoseconds()
+			finished = append(finished, worker)
+
+			elapsed := worker.Elapsed()
+			log.Printf("[%s] Got results after %.2f seconds, %d still running", worker.id, elapsed, pending)
+
+			call := worker.call
 			if call.Error != nil {
 				log.Printf("[%s] Error state reported: %s", worker.id, call.Error.String())
+				coordinator.WorkerFinished(worker, call.Error.String(), true)
+				success = false
+				continue
+			}
+
+			// Prefer the times the worker actually started and finished the
+			// benchmark, corrected onto our own clock.
+			if worker.result.Started > 0 {
+				worker.date = worker.CoordinatorTime(worker.result.Started) / 1000000000
+			}
+			if worker.result.Finished > 0 {
+				worker.exited = worker.CoordinatorTime(worker.result.Finished)
+			}
+
+			perfdata, err := ParseResults(worker.result.Stdout, nanoid, worker.date, worker.args)
+			if err != nil {
+				// Error parsing, report this
+				log.Printf("[%s] Error parsing perf data: %s\n", worker.id, err.String())
+				coordinator.WorkerFinished(worker, "", true)
 				success = false
 			} else {
-				perfdata, err := ParseResults(worker.result.Stdout, nanoid, worker.date, worker.args)
-				if err != nil {
-					// Error parsing, report this
-					log.Printf("[%s] Error parsing perf data: %s\n", worker.id, err.String())
-					success = false
+				coordinator.WorkerFinished(worker, "", false)
+
+				perfdata.WorkerLabel = worker.label
+				perfdata.WorkerGroup = worker.group
+				perfdata.WorkerElapsed = elapsed
+				perfdata.TotalOfferedLoad = load
+
+				// Work out which URLs were requested when replaying a mix
+				if len(worker.args.WorkLog) > 0 {
+					counts := URLRequestCounts(worker.args.WorkLog, int(perfdata.TotalRequests))
+					perfdata.URLRequests = FormatURLCounts(counts)
+					urlCounts = addURLCounts(urlCounts, counts)
 				}
+
 				results = append(results, perfdata)
+			}
 
-				if len(worker.result.Stderr) > 0 {
-					log.Printf("[%s] Stderr: %s", worker.id, worker.result.Stderr)
+			if len(worker.result.Stderr) > 0 {
+				log.Printf("[%s] Stderr: %s", worker.id, worker.result.Stderr)
+			}
+		case <-ticker.C:
+			// Only report stragglers once at least one worker has finished,
+			// otherwise every worker is simply still running.
+			if len(finished) > 0 {
+				for _, worker := range workers {
+					if worker.call != nil && worker.finished == 0 {
+						log.Printf("[%s] Still running after %.2f seconds", worker.id,
+							float64(time.Nanoseconds()-worker.started)/1000000000)
+					}
 				}
 			}
 		}
 	}
 
+	// Report the spread between the fastest and slowest worker, as an
+	// indication of how evenly the load was balanced. The time each
+	// benchmark exited is used where known, so that a slow RPC reply isn't
+	// mistaken for a slow benchmark.
+	if len(finished) > 1 {
+		fastest := finished[0]
+		slowest := finished[len(finished)-1]
+		for _, worker := range finished {
+			if worker.RunTime() < fastest.RunTime() {
+				fastest = worker
+			}
+			if worker.RunTime() > slowest.RunTime() {
+				slowest = worker
+			}
+		}
+
+		log.Printf("Completion spread: %.2f seconds (fastest [%s] %.2f, slowest [%s] %.2f)",
+			slowest.RunTime()-fastest.RunTime(), fastest.id, fastest.RunTime(),
+			slowest.id, slowest.RunTime())
+	}
+
+	ReportGroups(results)
+
+	if len(urlCounts) > 0 {
+		log.Printf("Requests per URL: %s", FormatURLCounts(urlCounts))
+	}
+
+	if !success {
+		failedBenchmarks++
+	}
+
 	return results, success
 }
 
-// Stress test a server for maximum number of connections per second
-func StressTestConnections(workers []*Worker) {
-	// A list of stress and steps, these should be sequential
-	var stressRates = map[int]int{
-		0:   100, // Start benchmarking at rate 100
-		100: 100, // Step up 100 rate each round
-	}
-
-	// Fetch the starting connection rate from the map
-	rate := *startRate
-	step := stressRates[rate]
-	if step == 0 {
-		step = stressRates[0]
-	}
-
-	errorState := false
-	cooldownSteps := *cooldown
-
-	// Output the TSV header
-	WriteTSVHeader(os.Stdout)
-
-	for {
-		// Calculate the number of connections to request. Since we're distributing
-		// both the rate and the number of connections over several workers, this
-		// does not need to take that into account.
-		//
-		// 10 second duration with 300 connections per second is 3000 connections,
-		// regardless of how many clients are used to distribute that load.
-		numconns := *duration * rate
-		if numconns <= 0 {
-			numconns = 60 * rate
+// How often to report workers that are still running once others have
+// finished, in nanoseconds.
+const stragglerInterval = 30 * 1000000000
+
+// The progress of a connection stress test against a single target
+type stressRun struct {
+	phase         *Phase
+	rate, step    int
+	stepNum       int
+	errorState    bool
+	cooldownSteps int
+	done          bool
+	data          []*PerfData
+}
+
+func newStressRun(phase *Phase) *stressRun {
+	// Fetch the starting connection rate from the schedule
+	rate := phase.StartRate
+	return &stressRun{
+		phase:         phase,
+		rate:          rate,
+		step:          phase.StepAt(rate),
+		stepNum:       1,
+		cooldownSteps: phase.Cooldown,
+		data:          make([]*PerfData, 0),
+	}
+}
+
+// Stress test a server for maximum number of connections per second. When the
+// phase has several targets, each step is run against every one of them in
+// turn, so that they are all affected equally by time-of-day and network
+// noise, and each target stops according to its own results.
+func StressTestConnections(workers []*Worker, phase *Phase) []*PerfData {
+	runs := make([]*stressRun, 0)
+	for _, tp := range phase.TargetPhases() {
+		runs = append(runs, newStressRun(tp))
+	}
+
+	all := make([]*PerfData, 0)
+	started := false
+
+	for round := 0; ; round++ {
+		ran := false
+		for idx := range runs {
+			// Alternate the order of the targets each round, so that none is
+			// always measured first after a pause
+			run := runs[idx]
+			if round%2 == 1 {
+				run = runs[len(runs)-1-idx]
+			}
+			if run.done {
+				continue
+			}
+
+			// Perform any sleep, as directed
+			if started {
+				phase.Pause()
+			}
+			started = true
+			ran = true
+
+			if run.phase.target != "" {
+				log.Printf("Target %s, rate %d", run.phase.target, run.rate)
+			}
+
+			data := run.Step(workers)
+			run.data = append(run.data, data...)
+			all = append(all, data...)
 		}
 
-		args := new(Args)
-		args.Host = *server
-		args.Port = *port
-		args.URL = *url
-		args.NumConnections = numconns
-		args.ConnectionRate = rate
-		args.RequestsPerConnection = *requests
+		if !ran {
+			break
+		}
+	}
 
-		data, ok := RunDistributedBenchmark(workers, args)
-		if !ok {
-			log.Printf("Stress test for rate %d did not fully succeed", rate)
+	capacities := make([]*Capacity, 0, len(runs))
+	for _, run := range runs {
+		capacity := ReportCapacity(run.data, run.phase)
+		if *fitStress {
+			ReportUSL(capacity.Points, run.phase)
 		}
+		capacities = append(capacities, capacity)
+	}
+	CompareTargets(capacities)
+
+	return all
+}
 
-		WriteTSVParseDataSet(os.Stdout, data)
+// Run the next step of a stress test, and work out the rate of the step
+// after it, or whether the test is done.
+func (r *stressRun) Step(workers []*Worker) []*PerfData {
+	phase := r.phase
+
+	// The targets take turns, so show the state of this one while it runs
+	coordinator.SetStressState(phase, r.errorState, r.cooldownSteps)
+	data, stats := RunStressStep(workers, phase, r.rate, r.stepNum)
+
+	// Check if the mean of the trials is over the error threshold
+	hasErrors := stats.HasErrors(phase.NumErrors)
+
+	// Rather than carrying on upwards through the cooldown, step back
+	// down to find the rate at which the server recovers.
+	if hasErrors && phase.Recovery {
+		log.Printf("Errors at rate %d, stepping back down to find the recovery rate", r.rate)
+		data = append(data, FindRecoveryRate(workers, phase, r.rate, r.step, r.stepNum)...)
+		r.done = true
+		return data
+	}
+
+	if r.errorState && !hasErrors {
+		log.Printf("Exiting error state, server seems to have recovered")
+		r.errorState = false
+		r.cooldownSteps = phase.Cooldown
+	} else if !r.errorState && hasErrors {
+		log.Printf("Entering an error state, will cooldown for %d rounds", r.cooldownSteps)
+		r.errorState = true
+	}
+
+	if r.errorState {
+		r.cooldownSteps = r.cooldownSteps - 1
+		log.Printf("In an error state with %d rounds to go", r.cooldownSteps)
+	}
+	coordinator.SetStressState(phase, r.errorState, r.cooldownSteps)
 
-		// Check if the data set is over the error threshold
-		hasErrors := SetHasErrors(data, *numErrors)
+	// Stop benchmarking when we've run out of cooldown steps
+	if r.cooldownSteps < 0 {
+		r.done = true
+		return data
+	}
+
+	// Increment the rate/step accordingly.
+	r.rate = r.rate + r.step
+	r.step = phase.StepAt(r.rate)
+	r.stepNum++
 
-		if errorState && !hasErrors {
-			log.Printf("Exiting error state, server seems to have recovered")
-			errorState = false
-			cooldownSteps = *cooldown
-		} else if !errorState && hasErrors {
-			log.Printf("Entering an error state, will cooldown for %d rounds", cooldownSteps)
-			errorState = true
+	// Stop benchmarking when we've passed the maximum rate
+	if phase.MaxRate > 0 && r.rate > phase.MaxRate {
+		log.Printf("Reached the maximum rate of %d", phase.MaxRate)
+		r.done = true
+		return data
+	}
+
+	log.Printf("Current rate: %d, step: %d", r.rate, r.step)
+	return data
+}
+
+// Run a single step of a stress test at the given rate, repeating it for the
+// number of trials configured for the phase. Once every trial is complete,
+// the results are written as step 'stepNum' of the phase, along with the
+// statistics of the trials.
+func RunStressStep(workers []*Worker, phase *Phase, rate int, stepNum int) ([]*PerfData, *StepStats) {
+	// Calculate the number of connections to request. Since we're distributing
+	// both the rate and the number of connections over several workers, this
+	// does not need to take that into account.
+	//
+	// 10 second duration with 300 connections per second is 3000 connections,
+	// regardless of how many clients are used to distribute that load.
+	numconns := phase.Duration * rate
+	if numconns <= 0 {
+		numconns = 60 * rate
+	}
+
+	all := make([]*PerfData, 0)
+	trials := make([][]*PerfData, 0, phase.Repeat)
+
+	coordinator.SetStep(phase, stepNum, rate)
+
+	for trial := 1; trial <= phase.Repeat; trial++ {
+		if trial > 1 {
+			log.Printf("Trial %d of %d at rate %d", trial, phase.Repeat, rate)
+			phase.Pause()
 		}
 
-		if errorState {
-			cooldownSteps = cooldownSteps - 1
-			log.Printf("In an error state with %d rounds to go", cooldownSteps)
+		args := phase.NewArgs(numconns, rate)
+
+		// When stepping concurrency, the rate is the number of clients,
+		// which keep going for the duration of the step
+		if phase.StepConcurrency {
+			args.NumConnections = 0
+			args.ConnectionRate = 0
+			args.Concurrency = rate
+			args.Timeout = *timeout
+			if args.Duration <= 0 {
+				args.Duration = 60
+			}
 		}
 
-		// Stop benchmarking when we've run out of cooldown steps
-		if cooldownSteps < 0 {
-			break
+		data, ok := RunDistributedBenchmark(workers, args)
+		if !ok {
+			log.Printf("Stress test for rate %d did not fully succeed", rate)
 		}
+		LogThroughput(args, data)
 
-		// Increment the rate/step accordingly.
-		rate = rate + step
-		if newStep, ok := stressRates[rate]; ok {
-			step = newStep
+		for _, perfdata := range data {
+			perfdata.Trial = trial
 		}
 
-		log.Printf("Current rate: %d, step: %d", rate, step)
+		trials = append(trials, data)
+		all = append(all, data...)
+	}
+
+	stats := ComputeStepStats(trials, phase.Outliers)
+	if phase.Repeat > 1 {
+		log.Printf("Rate %d over %d trials: %.1f +/- %.1f conn/s, response %.1f +/- %.1f ms, %.1f +/- %.1f errors",
+			rate, phase.Repeat,
+			stats.ConnectionsPerSecond.Mean, stats.ConnectionsPerSecond.CI95,
+			stats.ReplyTimeResponse.Mean, stats.ReplyTimeResponse.CI95,
+			stats.ErrTotal.Mean, stats.ErrTotal.CI95)
+	}
+
+	stats.Apply(all)
+	phase.Tag(all, stepNum)
+	WriteResults(all)
 
-		// Perform any sleep, as directed
-		log.Printf("Sleeping for %d seconds", *sleep)
-		var sleeptime int64 = int64(*sleep) * 1000000000
-		time.Sleep(sleeptime)
-		log.Printf("Done sleeping")
+	return all, stats
+}
+
+// Log the throughput achieved by a closed-loop benchmark, which unlike the
+// rate of an open-loop benchmark is not known beforehand.
+func LogThroughput(args *Args, data []*PerfData) {
+	if args.Concurrency == 0 || len(data) == 0 {
+		return
 	}
+
+	agg := AggregatePerfData(data)
+	log.Printf("%d clients achieved %.1f req/s (%.1f conn/s), response %.1f ms, %.0f errors",
+		args.Concurrency, agg.RequestsPerSecond, agg.ConnectionsPerSecond,
+		agg.ReplyTimeResponse, agg.ErrTotal)
 }
 
 // Stress test a server for maximum number of requests per second
-func StressTestRequests(workers []*Worker) {
+func StressTestRequests(workers []*Worker, phase *Phase) []*PerfData {
+	return nil
 }
 
-func RunManualBenchmark(workers []*Worker) {
+func RunManualBenchmark(workers []*Worker, phase *Phase) []*PerfData {
 	// Number of connections is rate * duration
-	connections := *numConns
-	if *duration > 0 {
-		connections = *connRate * *duration
+	connections := phase.NumConnections
+	if phase.Duration > 0 {
+		connections = phase.Rate * phase.Duration
+	}
+
+	args := phase.NewArgs(connections, phase.Rate)
+
+	// A closed-loop benchmark runs for the duration, or until the number
+	// of connections have been made, regardless of the rate. The default
+	// number of connections doesn't cut a run with a duration short.
+	if phase.Concurrency > 0 {
+		args.NumConnections = phase.NumConnections
+		if phase.Duration > 0 && !phase.explicit("NumConnections", "numconns") {
+			args.NumConnections = 0
+		}
+		args.ConnectionRate = 0
+		args.Concurrency = phase.Concurrency
+		args.Timeout = *timeout
 	}
 
-	args := &Args{
-		*server,
-		*port,
-		*url,
-		connections,
-		*connRate,
-		*requests,
-		*duration,
+	load := args.ConnectionRate
+	if args.Concurrency > 0 {
+		load = args.Concurrency
 	}
+	coordinator.SetSchedule([]int{load})
+	coordinator.SetStep(phase, 1, load)
 
 	data, ok := RunDistributedBenchmark(workers, args)
 	if !ok {
 		log.Printf("Manual benchmark did not fully succeed")
 	}
+	LogThroughput(args, data)
 
-	// Write the TSV header
-	if !*skipheader {
-		WriteTSVHeader(os.Stdout)
-	}
-
-	// Write out the perf data for each benchmark
-	for idx, perfdata := range data {
-		if *dumpraw {
+	if *dumpraw {
+		for idx, perfdata := range data {
 			log.Printf("Client %d output: \n%s\n", idx, perfdata.Raw)
 		}
-		WriteTSVParseData(os.Stdout, perfdata)
 	}
+
+	// Write out the perf data for each benchmark
+	phase.Tag(data, 1)
+	WriteResults(data)
+
+	return data
 }
 
 // General options that every single mode will require
 var help *bool = flag.Bool("help", false, "Display usage information")
 var server *string = flag.String("server", "localhost", "The hostname or IP address of the server")
 var port *int = flag.Int("port", 80, "The port on which to bind the server")
+var targets *string = flag.String("targets", "", "A list of targets to stress test in turn instead of -server, e.g. \"old=10.0.0.1:80,new=10.0.0.2:80\" (stress only)")
 var url *string = flag.String("url", "/", "The URL to be requested")
-var timeout *int = flag.Int("timeout", 5, "Amount of time before a request is considered unfulfilled")
+var urlMix *string = flag.String("urlmix", "", "A weighted list of URLs to request instead of -url, e.g. \"/=50,/search?q=x=30\"")
+var timeout *int = flag.Int("timeout", 5, "Amount of time before a request is considered unfulfilled (closed-loop only)")
 
 // Flags that can be used to turn a mode on or off, these are combined and
 // will be executed in the order they are specified here, not the order they
-// are specified on the commandline.
+// are specified on the commandline. A scenario file replaces them with its
+// own list of phases.
 var modeStressConn *bool = flag.Bool("stressconn", false, "Perform a connection stress test")
 var modeStressReqs *bool = flag.Bool("stressreqs", false, "Perform a request stress test")
 var modeManual *bool = flag.Bool("manual", false, "Perform a manual benchmark")
+var modeSoak *bool = flag.Bool("soak", false, "Perform a soak test, holding -connrate for -soaktime")
+var modeSpike *bool = flag.Bool("spike", false, "Perform a spike test, alternating -connrate with bursts at -spikerate")
+var modeSweep *bool = flag.Bool("sweep", false, "Perform a parameter sweep over -sweepurls, -sweeprates and -sweeprequests")
+var scenario *string = flag.String("scenario", "", "A JSON scenario file listing the phases of the benchmark")
 
 // Manual mode options
 var numConns *int = flag.Int("numconns", 6000, "The number of connections to be opened (manual only)")
 var connRate *int = flag.Int("connrate", 200, "The rate of new connections (connections per second) (manual only)")
 var requests *int = flag.Int("requests", 5, "The number of requests sent per connection (manual only)")
 var duration *int= flag.Int("duration", 0, "The duration of the test to be performed")
+var concurrency *int = flag.Int("concurrency", 0, "The number of clients kept busy by a closed-loop benchmark instead of -connrate (manual only)")
 var skipheader *bool = flag.Bool("skipheader", false, "Do not print the CSV header")
 
+// Soak test options
+var soakTime *int = flag.Int("soaktime", 3600, "The total duration of the soak test in seconds (soak only)")
+var soakWindow *int = flag.Int("window", 300, "The duration of each soak test sampling window in seconds (soak only)")
+
+// Spike test options
+var spikeRate *int = flag.Int("spikerate", 1000, "The connection rate during each spike (spike only)")
+var spikes *int = flag.Int("spikes", 3, "The number of spikes (spike only)")
+var spikeLength *int = flag.Int("spikelength", 10, "The duration of each spike in seconds (spike only)")
+var spikeWindow *int = flag.Int("spikewindow", 30, "The duration of each baseline window in seconds (spike only)")
+var baselineWindows *int = flag.Int("baselinewindows", 3, "The number of baseline windows before the first spike and after each spike (spike only)")
+var recoveryTolerance *float64 = flag.Float64("recoverytolerance", 20, "How close (in percent) to the baseline a window must be to count as recovered (spike only)")
+
+// Sweep options
+var sweepURLs *string = flag.String("sweepurls", "", "A comma-separated list of URLs to sweep, defaults to -url (sweep only)")
+var sweepRates *string = flag.String("sweeprates", "", "A comma-separated list of connection rates to sweep, defaults to -connrate (sweep only)")
+var sweepRequests *string = flag.String("sweeprequests", "", "A comma-separated list of requests per connection to sweep, defaults to -requests (sweep only)")
+var sweepOrder *string = flag.String("sweeporder", "fixed", "The order in which to run the sweep, 'fixed' or 'random' (sweep only)")
+var sweepSeed *int64 = flag.Int64("sweepseed", 0, "The seed for a random sweep order, 0 to pick one (sweep only)")
+
+// Warmup options
+var warmup *int = flag.Int("warmup", 0, "The duration in seconds of an unmeasured warmup before the first phase")
+var warmupRate *int = flag.Int("warmuprate", 0, "The connection rate (or closed-loop clients) used during the warmup, defaults to the first rate of the phase")
+var writeWarmup *bool = flag.Bool("writewarmup", false, "Write the warmup results, marked in the Warmup column")
+
 // Stress test options
 var numErrors *int = flag.Int("numerrors", 500, "The maximum acceptable number of errors to indicate 'stressed' (stress only)")
 var cooldown *int = flag.Int("cooldown", 3, "The number of steps to take following an 'error state' (stress only)")
 var sleep *int = flag.Int("sleeptime", 5, "The amount of time (in seconds) to sleep between each round (stress only)")
 var startRate *int = flag.Int("startrate", 100, "The connection start rate for the stress test")
+var maxRate *int = flag.Int("maxrate", 0, "Stop the stress test once the rate passes this, 0 for no limit (stress only)")
+var maxLatency *float64 = flag.Float64("maxlatency", 0, "The highest acceptable reply time in ms for the capacity summary, 0 to ignore (stress only)")
+var summaryFile *string = flag.String("summary", "", "Write the capacity summary of each stress test to this JSON file (stress only)")
+var fitStress *bool = flag.Bool("fit", false, "Fit a scalability model at the end of each stress test (stress only)")
+var stepConcurrency *bool = flag.Bool("stepconcurrency", false, "Step the number of closed-loop clients instead of the connection rate (stress only)")
+var recovery *bool = flag.Bool("recovery", false, "After errors appear, step the rate back down to find where the server recovers (stress only)")
+var repeat *int = flag.Int("repeat", 1, "The number of trials of each step (stress only)")
+var outliers *float64 = flag.Float64("outliers", 0, "Reject throughput and reply time trials this many median absolute deviations from the median, 0 to keep all (stress only)")
+var recoveryStep *int = flag.Int("recoverystep", 0, "The step size of the recovery search, defaults to the current step (stress only)")
 var dumpraw *bool = flag.Bool("dumpraw", true, "Dump the raw client output to stderr")
 
+// Options for the 'fit' subcommand, and -fit
+var amdahl *bool = flag.Bool("amdahl", false, "Fit Amdahl's law rather than the Universal Scalability Law")
+var fitPhase *string = flag.String("fitphase", "", "Only fit results from this phase (fit only)")
+
+// Options for the 'compare' subcommand, and -baseline
+var thresholdSpec *string = flag.String("thresholds", "Throughput=-5%,Latency=+10%,Errors=+0", "The changes in Throughput, Latency and Errors beyond which a result is a regression")
+
+// Report options
+var htmlReport *string = flag.String("html", "", "Write a self-contained HTML report with charts of the run to this file")
+var gnuplotPrefix *string = flag.String("gnuplot", "", "Write the results as a gnuplot data file and script, named after this prefix")
+var gnuplotWorkers *bool = flag.Bool("plotworkers", false, "Plot a series for each worker rather than combining them (gnuplot only)")
+
+// CI options, compared using -thresholds
+var baseline *string = flag.String("baseline", "", "A results file to compare the run against, exiting non-zero on a regression beyond -thresholds")
+var junit *string = flag.String("junit", "", "Write a JUnit XML report of the run and its comparison with -baseline to this file")
+
+// Worker preflight options
+var clockSamples *int = flag.Int("clocksamples", 8, "The number of clock samples taken from each worker before benchmarking")
+var maxSkew *int = flag.Int("maxskew", 100, "Warn when a worker clock differs from ours by more than this many milliseconds")
+
+// Local worker options
+var localWorkers *int = flag.Int("localworkers", 0, "The number of worker daemons to start on this machine, bound to loopback")
+var localDaemon *string = flag.String("localdaemon", "autohttperf_daemon", "The worker daemon executable used for local workers")
+var localPort *int = flag.Int("localport", 17170, "The first port used for local workers")
+var inventory *string = flag.String("workers", "", "A JSON inventory file listing worker addresses, labels, weights and groups")
+
+// Monitoring options
+var influxDest *string = flag.String("influx", "", "Send each result as InfluxDB line protocol to this file, tcp://host:port or udp://host:port")
+var graphiteDest *string = flag.String("graphite", "", "Send each result as Graphite plaintext to this file, tcp://host:port or udp://host:port")
+var graphitePrefix *string = flag.String("graphiteprefix", "autohttperf", "The prefix of every Graphite metric path")
+var showDashboard *bool = flag.Bool("dashboard", false, "Show the progress of the run on a full-screen terminal dashboard in place of the log")
+var metricsListen *string = flag.String("metrics-listen", "", "Serve Prometheus metrics of the run's progress at /metrics on this address, e.g. \":9100\"")
+
 var PrintUsage = func() {
 	fmt.Fprintf(os.Stderr, "Usage of %s: \"host1:port1\" ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s fit results.csv ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s compare baseline.csv results.csv\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s plot results.csv ...\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
@@ -253,36 +602,155 @@ func main() {
 		return
 	}
 
-	// Build a slice of RPC clients, as specified by the user as arguments
-	workers := make([]*Worker, 0, 5)
+	// Subcommands work on stored results rather than running a benchmark
+	if flag.Arg(0) == "fit" {
+		if err := RunFit(flag.Args()[1:]); err != nil {
+			log.Fatalf("Could not fit a model: %s", err.String())
+		}
+		return
+	}
+	if flag.Arg(0) == "plot" {
+		if err := RunPlot(flag.Args()[1:]); err != nil {
+			log.Fatalf("Could not plot results: %s", err.String())
+		}
+		return
+	}
+	if flag.Arg(0) == "compare" {
+		if err := RunCompare(flag.Args()[1:]); err != nil {
+			log.Fatalf("Could not compare results: %s", err.String())
+		}
+		return
+	}
+
+	var phases []*Phase
+	var err os.Error
 
-	for idx, arg := range flag.Args() {
-		log.Printf("Opening RPC connection to %s", arg)
-		client, err := rpc.DialHTTP("tcp", arg)
+	if *scenario != "" {
+		phases, err = LoadScenario(*scenario)
+		if err != nil {
+			log.Fatalf("Could not load scenario: %s", err.String())
+		}
+	} else {
+		if !*modeStressConn && !*modeStressReqs && !*modeManual && !*modeSoak && !*modeSpike && !*modeSweep {
+			log.Fatalf("No mode selected, please supply one of -stressconn, -stressreqs, -manual, -soak, -spike, -sweep or -scenario")
+		}
+
+		phases, err = PhasesFromFlags()
+		if err != nil {
+			log.Fatalf("Invalid options: %s", err.String())
+		}
+	}
+
+	// Check the thresholds now, rather than after a long run
+	if *baseline != "" {
+		if _, err := ParseThresholds(*thresholdSpec); err != nil {
+			log.Fatalf("Invalid thresholds: %s", err.String())
+		}
+	}
+
+	// The -warmup flag warms up the server before the first phase, unless
+	// the scenario already gives it a warmup of its own, even one of zero.
+	if *warmup > 0 && phases[0].unset("Warmup", phases[0].Warmup == 0) {
+		phases[0].Warmup = *warmup
+	}
+
+	// The workers are specified by the user as arguments, in an inventory
+	// file, or as local workers we have been asked to start ourselves.
+	entries := make([]InventoryEntry, 0, 5)
+	for _, arg := range flag.Args() {
+		entries = append(entries, InventoryEntry{Address: arg})
+	}
+
+	var groups []GroupSpec
+
+	if *inventory != "" {
+		inv, err := LoadInventory(*inventory)
+		if err != nil {
+			log.Fatalf("Could not load worker inventory: %s", err.String())
+		}
+		entries = append(entries, inv.Workers...)
+		groups = inv.Groups
+	}
+
+	if *localWorkers > 0 {
+		local, err := StartLocalWorkers(*localWorkers)
+		if err != nil {
+			log.Fatalf("Could not start local workers: %s", err.String())
+		}
+		defer StopLocalWorkers()
+
+		for _, addr := range local {
+			entries = append(entries, InventoryEntry{Address: addr, Group: "local"})
+		}
+	}
+
+	if len(entries) == 0 {
+		log.Fatalf("No workers specified, please supply worker addresses, -workers or -localworkers")
+	}
+
+	// Build a slice of RPC clients, one for each worker
+	workers := make([]*Worker, 0, len(entries))
+
+	for idx, entry := range entries {
+		log.Printf("Opening RPC connection to %s", entry.Address)
+		client, err := rpc.DialHTTP("tcp", entry.Address)
 		log.Printf("New RPC connection %p", client)
 
 		if err != nil {
-			log.Fatalf("Could not connect to client %s: %s", arg, err)
+			fatalf("Could not connect to client %s: %s", entry.Address, err)
 		}
 
-		id := fmt.Sprintf("%s:%d", arg, idx)
-		worker := &Worker{arg, id, client, nil, nil, 0, nil}
+		id := fmt.Sprintf("%s:%d", entry.Address, idx)
+		worker := NewWorker(id, client, entry)
 		workers = append(workers, worker)
 	}
 
-	if !*modeStressConn && !*modeStressReqs && !*modeManual {
-		log.Fatalf("No mode selected, please supply one of -stressconn, -stressreqs or -manual")
+	if err := AssignGroups(workers, groups); err != nil {
+		fatalf("Could not assign group workloads: %s", err.String())
+	}
+
+	if err := OpenExporters(); err != nil {
+		fatalf("Could not open the result exporters: %s", err.String())
 	}
 
-	if *modeManual {
-		RunManualBenchmark(workers)
+	coordinator.SetWorkers(workers)
+	if *metricsListen != "" {
+		ServeMetrics(*metricsListen)
 	}
 
-	if *modeStressConn {
-		StressTestConnections(workers)
+	// Measure the clock offset of each worker so any timestamps they report
+	// can be corrected onto our clock.
+	SyncClocks(workers)
+
+	// The dashboard draws on stderr, so the results on stdout should be
+	// redirected to a file
+	var dashboard *Dashboard
+	if *showDashboard {
+		dashboard = NewDashboard(os.Stderr, coordinator)
+		dashboard.Start()
+	}
+
+	data := RunPhases(workers, phases)
+
+	if dashboard != nil {
+		dashboard.Stop()
+	}
+
+	if *htmlReport != "" {
+		if err := writeHTMLFile(*htmlReport, data, phases); err != nil {
+			log.Printf("Could not write the HTML report: %s", err.String())
+		}
+	}
+	if *gnuplotPrefix != "" {
+		if err := writeGnuplotFiles(*gnuplotPrefix, data, *gnuplotWorkers); err != nil {
+			log.Printf("Could not write the gnuplot files: %s", err.String())
+		}
 	}
 
-	if *modeStressReqs {
-		StressTestRequests(workers)
+	// Exit with a failure status if any benchmark failed or regressed from
+	// the baseline, so that a CI pipeline can gate on the run
+	if status := RunGate(data); status != 0 {
+		StopLocalWorkers()
+		os.Exit(status)
 	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import "log"
+import "os"
+import "time"
+
+// A single clock exchange with a worker. The worker time is sampled once
+// while handling the request, so the usual four NTP timestamps collapse
+// into three.
+type clockSample struct {
+	sent     int64 // Our clock when the request was sent
+	worker   int64 // The worker clock while handling the request
+	received int64 // Our clock when the reply arrived
+}
+
+// Estimate the offset of the worker clock from ours, along with the
+// round-trip time of the sample used. The sample with the shortest round
+// trip is the one least affected by network delay, so it is preferred.
+func estimateClockOffset(samples []clockSample) (offset int64, rtt int64) {
+	best := -1
+	for idx, sample := range samples {
+		if best < 0 || sample.received-sample.sent < samples[best].received-samples[best].sent {
+			best = idx
+		}
+	}
+
+	if best < 0 {
+		return 0, 0
+	}
+
+	sample := samples[best]
+	rtt = sample.received - sample.sent
+	offset = sample.worker - (sample.sent+sample.received)/2
+	return offset, rtt
+}
+
+// Sample the clock of a single worker over the existing RPC connection
+func sampleWorkerClock(worker *Worker, count int) ([]clockSample, os.Error) {
+	samples := make([]clockSample, 0, count)
+
+	for i := 0; i < count; i++ {
+		args := &Clock{time.Nanoseconds()}
+		reply := new(Clock)
+
+		sent := time.Nanoseconds()
+		err := worker.client.Call("HTTPerf.Time", args, reply)
+		received := time.Nanoseconds()
+
+		if err != nil {
+			return samples, err
+		}
+
+		samples = append(samples, clockSample{sent, reply.Nanoseconds, received})
+	}
+
+	return samples, nil
+}
+
+// Measure the clock offset and round-trip time of each worker, storing the
+// results in the Worker structures. A warning is logged for any worker whose
+// clock differs from ours by more than the maximum skew.
+func SyncClocks(workers []*Worker) {
+	maxOffset := int64(*maxSkew) * 1000000
+
+	for _, worker := range workers {
+		samples, err := sampleWorkerClock(worker, *clockSamples)
+		if err != nil {
+			log.Printf("[%s] Could not sample worker clock: %s", worker.id, err.String())
+		}
+
+		if len(samples) == 0 {
+			worker.offset = 0
+			worker.rtt = 0
+			continue
+		}
+
+		worker.offset, worker.rtt = estimateClockOffset(samples)
+		log.Printf("[%s] Clock offset %.3f ms, round trip %.3f ms", worker.id,
+			float64(worker.offset)/1000000, float64(worker.rtt)/1000000)
+
+		if worker.offset > maxOffset || worker.offset < -maxOffset {
+			log.Printf("[%s] WARNING: worker clock is skewed by %.3f ms (maximum %d ms)",
+				worker.id, float64(worker.offset)/1000000, *maxSkew)
+		}
+	}
+}
+
+// Convert a worker timestamp (ns) into our own clock
+func (w *Worker) CoordinatorTime(ns int64) int64 {
+	return ns - w.offset
+}
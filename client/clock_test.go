@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestEstimateClockOffset(t *testing.T) {
+	samples := []clockSample{
+		{1000, 6000, 3000},   // rtt 2000, offset 4000
+		{5000, 10600, 6000},  // rtt 1000, offset 5100
+		{9000, 15000, 13000}, // rtt 4000, offset 4000
+	}
+
+	offset, rtt := estimateClockOffset(samples)
+	if rtt != 1000 {
+		t.Errorf("Expected round trip of 1000, got %d", rtt)
+	}
+	if offset != 5100 {
+		t.Errorf("Expected offset of 5100, got %d", offset)
+	}
+
+	offset, rtt = estimateClockOffset(nil)
+	if offset != 0 || rtt != 0 {
+		t.Errorf("Expected zero offset and round trip with no samples, got %d and %d", offset, rtt)
+	}
+}
+
+func TestWorkerRunTime(t *testing.T) {
+	worker := &Worker{started: 1000000000, finished: 13000000000}
+	if worker.RunTime() != 12 {
+		t.Errorf("Expected the collection time without an exit time, got %f", worker.RunTime())
+	}
+
+	// The worker's clock is 5 seconds ahead of ours
+	worker.offset = 5000000000
+	worker.exited = worker.CoordinatorTime(16000000000)
+	if worker.RunTime() != 10 || worker.Elapsed() != 12 {
+		t.Errorf("Expected 10 seconds to the exit and 12 to collection, got %f and %f",
+			worker.RunTime(), worker.Elapsed())
+	}
+}
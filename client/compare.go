@@ -0,0 +1,363 @@
+package main
+
+import "fmt"
+import "log"
+import "os"
+import "strconv"
+import "strings"
+
+// The metrics compared between two sets of results, named after the fields
+// of CapacityPoint
+var compareMetrics = []string{"Throughput", "Latency", "Errors"}
+
+// A limit on the change in a metric from a baseline, e.g. "Throughput=-5%"
+// flags a fall of more than 5% in throughput, and "Errors=+10" flags a rise
+// of more than 10 errors.
+type Threshold struct {
+	Metric  string
+	Limit   float64 // The size of the change allowed, never negative
+	Percent bool    // Whether the limit is a percentage of the baseline
+	Rise    bool    // Whether a rise, rather than a fall, is a regression
+}
+
+// Parse a comma-separated list of thresholds, such as
+// "Throughput=-5%,Latency=+10%,Errors=+0". Each must give the direction of
+// the change that counts as a regression.
+func ParseThresholds(spec string) ([]Threshold, os.Error) {
+	thresholds := make([]Threshold, 0, len(compareMetrics))
+
+	for _, entry := range strings.Split(spec, ",", -1) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		sep := strings.Index(entry, "=")
+		if sep <= 0 {
+			return nil, os.NewError(fmt.Sprintf("Threshold '%s' has no limit", entry))
+		}
+
+		threshold := Threshold{Metric: entry[:sep]}
+		known := false
+		for _, metric := range compareMetrics {
+			if threshold.Metric == metric {
+				known = true
+			}
+		}
+		if !known {
+			return nil, os.NewError(fmt.Sprintf("Threshold '%s' is for an unknown metric, expected one of %s",
+				entry, strings.Join(compareMetrics, ", ")))
+		}
+
+		limit := entry[sep+1:]
+		if strings.HasSuffix(limit, "%") {
+			threshold.Percent = true
+			limit = limit[:len(limit)-1]
+		}
+		if len(limit) < 2 || (limit[0] != '+' && limit[0] != '-') {
+			return nil, os.NewError(fmt.Sprintf("Threshold '%s' must start its limit with + or -", entry))
+		}
+		threshold.Rise = limit[0] == '+'
+
+		value, err := strconv.Atof64(limit[1:])
+		if err != nil || value < 0 {
+			return nil, os.NewError(fmt.Sprintf("Threshold '%s' has an invalid limit", entry))
+		}
+		threshold.Limit = value
+
+		thresholds = append(thresholds, threshold)
+	}
+
+	return thresholds, nil
+}
+
+// Whether the change in a metric from base to current goes beyond the
+// threshold. A percentage change from a zero baseline only counts if it is
+// in the direction of a regression.
+func (t Threshold) Exceeded(base float64, current float64) bool {
+	change := current - base
+	if !t.Rise {
+		change = -change
+	}
+
+	if t.Percent {
+		if base == 0 {
+			return change > 0
+		}
+		change = change / base * 100
+		if base < 0 {
+			change = -change
+		}
+	}
+
+	return change > t.Limit
+}
+
+func (t Threshold) String() string {
+	sign := "-"
+	if t.Rise {
+		sign = "+"
+	}
+	unit := ""
+	if t.Percent {
+		unit = "%"
+	}
+	return fmt.Sprintf("%s=%s%g%s", t.Metric, sign, t.Limit, unit)
+}
+
+// The value of one of the compared metrics at a point
+func pointMetric(point CapacityPoint, metric string) float64 {
+	switch metric {
+	case "Throughput":
+		return point.Throughput
+	case "Latency":
+		return point.Latency
+	case "Errors":
+		return point.Errors
+	}
+	return 0
+}
+
+// The change in a metric at a single point between two sets of results: a
+// rate, along with the step and swept values when those tell points at the
+// same rate apart
+type MetricDelta struct {
+	Phase         string
+	Target        string
+	Rate          int
+	Step          int
+	SweepURL      string
+	SweepRequests int
+	Metric        string
+	Base          float64
+	Current       float64
+	Regression    bool   // Whether the change is beyond a threshold
+	Threshold     string // The threshold that was exceeded, if any
+}
+
+func (d *MetricDelta) Change() float64 {
+	return d.Current - d.Base
+}
+
+func (d *MetricDelta) PercentChange() float64 {
+	return percentOf(d.Base, d.Current)
+}
+
+// A description of the point, such as "rate 100 step 3"
+func (d *MetricDelta) Where() string {
+	where := fmt.Sprintf("rate %d", d.Rate)
+	if d.Step > 0 {
+		where += fmt.Sprintf(" step %d", d.Step)
+	}
+	if d.SweepURL != "" {
+		where += " url " + d.SweepURL
+	}
+	if d.SweepRequests > 0 {
+		where += fmt.Sprintf(" requests %d", d.SweepRequests)
+	}
+	return where
+}
+
+// A phase and target, which together identify a series of results
+type resultSeries struct {
+	Phase  string
+	Target string
+}
+
+// Split a set of results into its series, in the order they first appear
+func splitSeries(data []*PerfData) ([]resultSeries, map[string][]*PerfData) {
+	order := make([]resultSeries, 0)
+	series := make(map[string][]*PerfData)
+
+	for _, perfdata := range data {
+		s := resultSeries{perfdata.Phase, perfdata.Target}
+		key := s.Phase + "\x00" + s.Target
+		if _, ok := series[key]; !ok {
+			order = append(order, s)
+		}
+		series[key] = append(series[key], perfdata)
+	}
+
+	return order, series
+}
+
+// The key of the group of points a result belongs to: its swept values,
+// and its step if byStep is set. Points are then told apart by rate.
+func compareGroupKey(perfdata *PerfData, byStep bool) string {
+	key := fmt.Sprintf("%s\x00%d", perfdata.SweepURL, perfdata.SweepRequests)
+	if byStep {
+		key += fmt.Sprintf("\x00%d", perfdata.Step)
+	}
+	return key
+}
+
+// Split a series into groups of results by their swept values, and step if
+// byStep is set, in the order they first appear. Warmup results are left out.
+func splitGroups(data []*PerfData, byStep bool) ([]string, map[string][]*PerfData) {
+	order := make([]string, 0)
+	groups := make(map[string][]*PerfData)
+
+	for _, perfdata := range data {
+		if perfdata.Warmup {
+			continue
+		}
+		key := compareGroupKey(perfdata, byStep)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], perfdata)
+	}
+
+	return order, groups
+}
+
+// Whether a series has several steps at the same rate and swept values, such
+// as the windows of a soak test, which should be told apart by their step
+func repeatsRates(data []*PerfData) bool {
+	seen := make(map[string]bool)
+	_, groups := splitGroups(data, true)
+
+	for _, rows := range groups {
+		for _, point := range BenchmarkPoints(rows) {
+			key := fmt.Sprintf("%s\x00%d", compareGroupKey(rows[0], false), point.Rate)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+		}
+	}
+	return false
+}
+
+// Compare two sets of results, aligning them by phase, target and offered
+// rate, and also by the swept values of a sweep and the step of a phase that
+// holds a rate for several steps. Points only present in one set are
+// skipped. Each change is checked against the thresholds for its metric.
+func CompareResults(base []*PerfData, current []*PerfData, thresholds []Threshold) []*MetricDelta {
+	deltas := make([]*MetricDelta, 0)
+
+	_, baseSeries := splitSeries(base)
+	order, currentSeries := splitSeries(current)
+
+	for _, series := range order {
+		key := series.Phase + "\x00" + series.Target
+		baseData, ok := baseSeries[key]
+		if !ok {
+			continue
+		}
+		currentData := currentSeries[key]
+
+		byStep := repeatsRates(baseData) || repeatsRates(currentData)
+		_, baseGroups := splitGroups(baseData, byStep)
+		groupOrder, currentGroups := splitGroups(currentData, byStep)
+
+		for _, groupKey := range groupOrder {
+			baseRows, ok := baseGroups[groupKey]
+			if !ok {
+				continue
+			}
+
+			basePoints := make(map[int]CapacityPoint)
+			for _, point := range BenchmarkPoints(baseRows) {
+				basePoints[point.Rate] = point
+			}
+
+			first := currentGroups[groupKey][0]
+			step := 0
+			if byStep {
+				step = first.Step
+			}
+
+			for _, point := range BenchmarkPoints(currentGroups[groupKey]) {
+				basePoint, ok := basePoints[point.Rate]
+				if !ok {
+					continue
+				}
+
+				for _, metric := range compareMetrics {
+					delta := &MetricDelta{
+						Phase:         series.Phase,
+						Target:        series.Target,
+						Rate:          point.Rate,
+						Step:          step,
+						SweepURL:      first.SweepURL,
+						SweepRequests: first.SweepRequests,
+						Metric:        metric,
+						Base:          pointMetric(basePoint, metric),
+						Current:       pointMetric(point, metric),
+					}
+
+					for _, threshold := range thresholds {
+						if threshold.Metric == metric && threshold.Exceeded(delta.Base, delta.Current) {
+							delta.Regression = true
+							delta.Threshold = threshold.String()
+						}
+					}
+
+					deltas = append(deltas, delta)
+				}
+			}
+		}
+	}
+
+	return deltas
+}
+
+// The number of changes that are regressions
+func CountRegressions(deltas []*MetricDelta) int {
+	count := 0
+	for _, delta := range deltas {
+		if delta.Regression {
+			count++
+		}
+	}
+	return count
+}
+
+// Log each of the changes that are regressions
+func LogRegressions(deltas []*MetricDelta) {
+	for _, delta := range deltas {
+		if delta.Regression {
+			log.Printf("REGRESSION: phase %s %s: %s %.1f -> %.1f (%+.1f%%), beyond %s", delta.Phase,
+				delta.Where(), delta.Metric, delta.Base, delta.Current, delta.PercentChange(), delta.Threshold)
+		}
+	}
+}
+
+// The 'compare' subcommand, which prints the change in each metric at each
+// rate from a baseline results file to a new one, and flags regressions
+// beyond the -thresholds.
+func RunCompare(filenames []string) os.Error {
+	if len(filenames) != 2 {
+		return os.NewError("Expected a baseline and a new result file to compare")
+	}
+
+	thresholds, err := ParseThresholds(*thresholdSpec)
+	if err != nil {
+		return err
+	}
+
+	base, err := ReadTSVParseDataFile(filenames[0])
+	if err != nil {
+		return err
+	}
+	current, err := ReadTSVParseDataFile(filenames[1])
+	if err != nil {
+		return err
+	}
+
+	deltas := CompareResults(base, current, thresholds)
+	if len(deltas) == 0 {
+		return os.NewError(fmt.Sprintf("%s and %s have no phases and rates in common", filenames[0], filenames[1]))
+	}
+
+	fmt.Printf("Phase,Target,Rate,Step,SweepURL,SweepRequests,Metric,Baseline,Current,Change,PercentChange,Regression\n")
+	for _, delta := range deltas {
+		fmt.Printf("%s,%s,%d,%d,%s,%d,%s,%.1f,%.1f,%+.1f,%+.1f,%s\n", delta.Phase, delta.Target, delta.Rate,
+			delta.Step, delta.SweepURL, delta.SweepRequests, delta.Metric, delta.Base, delta.Current, delta.Change(), delta.PercentChange(), delta.Threshold)
+	}
+
+	LogRegressions(deltas)
+	log.Printf("%d of %d changes are regressions", CountRegressions(deltas), len(deltas))
+	return nil
+}
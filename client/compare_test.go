@@ -0,0 +1,140 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds("Throughput=-5%, Latency=+10%,Errors=+0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.String())
+	}
+
+	if len(thresholds) != 3 {
+		t.Fatalf("Expected 3 thresholds, got %d", len(thresholds))
+	}
+
+	throughput := thresholds[0]
+	if throughput.Metric != "Throughput" || throughput.Limit != 5 || !throughput.Percent || throughput.Rise {
+		t.Errorf("Unexpected throughput threshold %v", throughput)
+	}
+
+	errors := thresholds[2]
+	if errors.Metric != "Errors" || errors.Limit != 0 || errors.Percent || !errors.Rise {
+		t.Errorf("Unexpected errors threshold %v", errors)
+	}
+
+	for _, spec := range []string{"Throughput=5%", "Bogus=+5", "Latency", "Latency=+x"} {
+		if _, err := ParseThresholds(spec); err == nil {
+			t.Errorf("Expected an error parsing '%s'", spec)
+		}
+	}
+}
+
+func TestThresholdExceeded(t *testing.T) {
+	fall := Threshold{"Throughput", 5, true, false}
+	if fall.Exceeded(100, 96) {
+		t.Errorf("A 4%% fall should be within -5%%")
+	}
+	if !fall.Exceeded(100, 94) {
+		t.Errorf("A 6%% fall should be beyond -5%%")
+	}
+	if fall.Exceeded(100, 200) {
+		t.Errorf("A rise should never be beyond -5%%")
+	}
+
+	rise := Threshold{"Errors", 0, false, true}
+	if rise.Exceeded(10, 10) {
+		t.Errorf("No change should be within +0")
+	}
+	if !rise.Exceeded(0, 1) {
+		t.Errorf("A rise of one should be beyond +0")
+	}
+}
+
+const baseResults = `BenchmarkId,Phase,ArgConnectionRate,ConnectionsPerSecond,ReplyTimeResponse,TotalReplies,ErrTotal
+a,ramp,50,50,10,500,0
+a,ramp,50,50,10,500,0
+b,ramp,200,200,20,2000,0
+`
+
+const currentResults = `BenchmarkId,Phase,ArgConnectionRate,ConnectionsPerSecond,ReplyTimeResponse,TotalReplies,ErrTotal
+c,ramp,50,50,10,500,0
+c,ramp,50,50,10,500,0
+d,ramp,200,150,30,1500,5
+e,ramp,300,300,30,3000,0
+`
+
+func TestCompareResults(t *testing.T) {
+	base, err := ReadTSVParseData(strings.NewReader(baseResults))
+	if err != nil {
+		t.Fatalf("Could not read the baseline: %s", err.String())
+	}
+	current, err := ReadTSVParseData(strings.NewReader(currentResults))
+	if err != nil {
+		t.Fatalf("Could not read the results: %s", err.String())
+	}
+
+	thresholds, _ := ParseThresholds("Throughput=-5%,Latency=+10%,Errors=+0")
+	deltas := CompareResults(base, current, thresholds)
+
+	// Rate 300 is not in the baseline, so only 100 and 200 are compared
+	if len(deltas) != 2*len(compareMetrics) {
+		t.Fatalf("Expected %d deltas, got %d", 2*len(compareMetrics), len(deltas))
+	}
+
+	for _, delta := range deltas {
+		if delta.Rate == 100 && delta.Regression {
+			t.Errorf("Unexpected regression in %s at rate 100", delta.Metric)
+		}
+		if delta.Rate == 200 && !delta.Regression {
+			t.Errorf("Expected a regression in %s at rate 200", delta.Metric)
+		}
+	}
+
+	if count := CountRegressions(deltas); count != 3 {
+		t.Errorf("Expected 3 regressions, got %d", count)
+	}
+}
+
+const baseWindows = `BenchmarkId,Phase,Step,SweepURL,TotalOfferedLoad,ArgConnectionRate,ConnectionsPerSecond,ReplyTimeResponse,TotalReplies,ErrTotal
+a,soak,1,,100,100,100,10,1000,0
+b,soak,2,,100,100,100,10,1000,0
+c,sweep,1,/a,100,100,100,10,1000,0
+d,sweep,2,/b,100,100,100,50,1000,0
+`
+
+const currentWindows = `BenchmarkId,Phase,Step,SweepURL,TotalOfferedLoad,ArgConnectionRate,ConnectionsPerSecond,ReplyTimeResponse,TotalReplies,ErrTotal
+e,soak,1,,100,100,100,10,1000,0
+f,soak,2,,100,100,100,20,1000,0
+g,sweep,1,/a,100,100,100,10,1000,0
+h,sweep,2,/b,100,100,100,50,1000,0
+`
+
+func TestCompareSameRate(t *testing.T) {
+	base, err := ReadTSVParseData(strings.NewReader(baseWindows))
+	if err != nil {
+		t.Fatalf("Could not read the baseline: %s", err.String())
+	}
+	current, err := ReadTSVParseData(strings.NewReader(currentWindows))
+	if err != nil {
+		t.Fatalf("Could not read the results: %s", err.String())
+	}
+
+	thresholds, _ := ParseThresholds("Latency=+10%")
+	deltas := CompareResults(base, current, thresholds)
+
+	// Each soak window and sweep combination is a point of its own
+	if len(deltas) != 4*len(compareMetrics) {
+		t.Fatalf("Expected %d deltas, got %d", 4*len(compareMetrics), len(deltas))
+	}
+
+	for _, delta := range deltas {
+		regression := delta.Phase == "soak" && delta.Step == 2 && delta.Metric == "Latency"
+		if delta.Regression != regression {
+			t.Errorf("Unexpected regression state %v for %s at %s", delta.Regression, delta.Metric, delta.Where())
+		}
+		if delta.Phase == "sweep" && (delta.Step != 0 || delta.SweepURL == "") {
+			t.Errorf("Expected sweep points told apart by URL, got %s", delta.Where())
+		}
+	}
+}
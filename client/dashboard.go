@@ -0,0 +1,344 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "log"
+import "os"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+// How often the dashboard is redrawn, in nanoseconds
+const dashboardInterval = 1000000000
+
+// The characters of a sparkline, from lowest to highest
+var sparkBlocks = []string{"▁", "▂", "▃", "▄", "▅", "▆", "▇", "█"}
+
+// A sparkline of the values, scaled from the lowest to the highest
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+
+	line := new(bytes.Buffer)
+	for _, value := range values {
+		level := 0
+		if max > min {
+			level = int((value - min) / (max - min) * float64(len(sparkBlocks)-1))
+		}
+		line.WriteString(sparkBlocks[level])
+	}
+	return line.String()
+}
+
+// A progress bar of the given width, including its brackets
+func progressBar(fraction float64, width int) string {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	filled := int(fraction * float64(width-2))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-2-filled) + "]"
+}
+
+// A number of seconds as h:mm:ss
+func formatClock(seconds int64) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// Cut a line down to the width of the screen, counting each UTF-8 character
+// (such as those of a sparkline) as a single column
+func clip(line string, width int) string {
+	columns := 0
+	for idx := 0; idx < len(line); idx++ {
+		if line[idx]&0xC0 != 0x80 {
+			columns++
+			if columns > width {
+				return line[:idx]
+			}
+		}
+	}
+	return line
+}
+
+// The rates of the steps run so far and to come, with the current step in
+// brackets. For a stress test, which has no schedule, these are the rates
+// it has visited. Earlier steps are dropped to fit the width.
+func scheduleLine(snapshot *StatusSnapshot, width int) string {
+	rates := make([]string, 0)
+	current := -1
+
+	if snapshot.Schedule != nil {
+		for idx, rate := range snapshot.Schedule {
+			if idx+1 == snapshot.Step {
+				current = len(rates)
+				rates = append(rates, fmt.Sprintf("[%d]", rate))
+			} else {
+				rates = append(rates, strconv.Itoa(rate))
+			}
+		}
+	} else {
+		for _, result := range recentSteps(snapshot) {
+			if result.Step != snapshot.Step {
+				rates = append(rates, strconv.Itoa(result.Rate))
+			}
+		}
+		if snapshot.Step > 0 {
+			current = len(rates)
+			rates = append(rates, fmt.Sprintf("[%d]", snapshot.Rate))
+		}
+		rates = append(rates, "...")
+	}
+
+	// Never drop the current step, or any before the end if there isn't one
+	if current < 0 {
+		current = len(rates) - 1
+	}
+
+	line := strings.Join(rates, " ")
+	for start := 1; start <= current && len(line) > width; start++ {
+		line = "... " + strings.Join(rates[start:], " ")
+	}
+	return line
+}
+
+// The recent steps against the current target
+func recentSteps(snapshot *StatusSnapshot) []StepResult {
+	steps := make([]StepResult, 0, len(snapshot.History))
+	for _, result := range snapshot.History {
+		if result.Target == snapshot.Target {
+			steps = append(steps, result)
+		}
+	}
+	return steps
+}
+
+// Draw a frame of the dashboard: the phase and its step, the schedule and
+// progress of the current benchmark, the state of a stress test, each
+// worker, sparklines of the recent steps and, in whatever room is left, the
+// latest lines of the log.
+func RenderDashboard(w io.Writer, snapshot *StatusSnapshot, logLines []string, started int64, now int64, width int, height int) {
+	lines := make([]string, 0, height)
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, clip(fmt.Sprintf(format, args...), width))
+	}
+
+	title := fmt.Sprintf("autohttperf  phase %s (%s)", snapshot.Phase, snapshot.Mode)
+	if snapshot.Target != "" {
+		title += "  target " + snapshot.Target
+	}
+	add("%s  running %s", title, formatClock((now-started)/1000000000))
+	add("")
+
+	if snapshot.Step == 0 && snapshot.Rate == 0 {
+		add("Waiting for the first step")
+	} else {
+		step := fmt.Sprintf("Step %d", snapshot.Step)
+		if snapshot.Step == 0 {
+			step = "Warmup"
+		} else if snapshot.Schedule != nil {
+			step = fmt.Sprintf("Step %d of %d", snapshot.Step, len(snapshot.Schedule))
+		}
+
+		progress := ""
+		if snapshot.BenchmarkStarted > 0 {
+			running := float64(now-snapshot.BenchmarkStarted) / 1000000000
+			if snapshot.BenchmarkLength > 0 {
+				progress = fmt.Sprintf("%s %.0fs / %ds", progressBar(running/float64(snapshot.BenchmarkLength), 32),
+					running, snapshot.BenchmarkLength)
+			} else {
+				progress = fmt.Sprintf("%.0fs", running)
+			}
+		}
+		add("%s  rate %d  %s", step, snapshot.Rate, progress)
+	}
+	add("Schedule: %s", scheduleLine(snapshot, width-10))
+
+	if snapshot.Mode == "stressconn" {
+		if snapshot.ErrorState {
+			add("State: ERROR, %d cooldown steps left", snapshot.Cooldown)
+		} else {
+			add("State: ok")
+		}
+	}
+
+	add("")
+	add("Workers")
+	for _, worker := range snapshot.Workers {
+		line := fmt.Sprintf("  %-20s %-10s %-8s %7.1fs  calls %d  failures %d",
+			worker.Label, worker.Group, worker.State, worker.Elapsed(), worker.Calls, worker.Failures)
+		if worker.LastError != "" {
+			line += "  " + worker.LastError
+		}
+		add("%s", line)
+	}
+
+	steps := recentSteps(snapshot)
+	if len(steps) > 0 {
+		throughput := make([]float64, len(steps))
+		latency := make([]float64, len(steps))
+		errors := make([]float64, len(steps))
+		for idx, result := range steps {
+			throughput[idx] = result.Throughput
+			latency[idx] = result.Latency
+			errors[idx] = result.Errors
+		}
+		last := steps[len(steps)-1]
+		pad := strings.Repeat(" ", statusHistory-len(steps))
+
+		add("")
+		add("Last %d steps", len(steps))
+		add("  Throughput  %s%s %.1f conn/s", Sparkline(throughput), pad, last.Throughput)
+		add("  Latency     %s%s %.1f ms", Sparkline(latency), pad, last.Latency)
+		add("  Errors      %s%s %.0f", Sparkline(errors), pad, last.Errors)
+	}
+
+	// The log fills whatever room is left
+	if room := height - len(lines) - 2; room > 0 && len(logLines) > 0 {
+		if len(logLines) > room {
+			logLines = logLines[len(logLines)-room:]
+		}
+		add("")
+		for _, line := range logLines {
+			add("%s", line)
+		}
+	}
+
+	io.WriteString(w, strings.Join(lines, "\n"))
+	io.WriteString(w, "\n")
+}
+
+// A full-screen view of the progress of the run, redrawn every second in
+// place of the log. The log is kept while the dashboard is showing, and
+// written out once it stops.
+type Dashboard struct {
+	out    io.Writer
+	status *Status
+	width  int
+	height int
+
+	lock    sync.Mutex
+	lines   []string
+	started int64
+	stop    chan bool
+	done    chan bool
+	stopped bool
+}
+
+// The dashboard that has the log, if any, so a fatal error can give the log
+// back before exiting
+var activeDashboard *Dashboard
+
+// The size of the terminal from $COLUMNS and $LINES, or 80x24
+func terminalSize() (int, int) {
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	height, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || height <= 0 {
+		height = 24
+	}
+	return width, height
+}
+
+func NewDashboard(out io.Writer, status *Status) *Dashboard {
+	width, height := terminalSize()
+	return &Dashboard{
+		out:    out,
+		status: status,
+		width:  width,
+		height: height,
+		lines:  make([]string, 0),
+		stop:   make(chan bool),
+		done:   make(chan bool),
+	}
+}
+
+// Keep a line of the log, so the dashboard is the log's output while it runs
+func (d *Dashboard) Write(p []byte) (int, os.Error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	text := strings.TrimRight(string(p), "\n")
+	d.lines = append(d.lines, strings.Split(text, "\n", -1)...)
+	return len(p), nil
+}
+
+// Take over the log and start drawing
+func (d *Dashboard) Start() {
+	d.started = time.Nanoseconds()
+	activeDashboard = d
+	log.SetOutput(d)
+	go d.run()
+}
+
+// Draw the last frame, give the log back and write out everything logged
+// while the dashboard was showing. Stopping it again does nothing.
+func (d *Dashboard) Stop() {
+	d.lock.Lock()
+	stopped := d.stopped
+	d.stopped = true
+	d.lock.Unlock()
+	if stopped {
+		return
+	}
+
+	d.stop <- true
+	<-d.done
+
+	log.SetOutput(d.out)
+	if activeDashboard == d {
+		activeDashboard = nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, line := range d.lines {
+		io.WriteString(d.out, line+"\n")
+	}
+}
+
+func (d *Dashboard) run() {
+	ticker := time.NewTicker(dashboardInterval)
+	d.draw()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.draw()
+		case <-d.stop:
+			ticker.Stop()
+			d.draw()
+			d.done <- true
+			return
+		}
+	}
+}
+
+func (d *Dashboard) draw() {
+	d.lock.Lock()
+	lines := d.lines
+	d.lock.Unlock()
+
+	// Clear the screen and draw from the top left
+	frame := new(bytes.Buffer)
+	frame.WriteString("\033[H\033[2J")
+	RenderDashboard(frame, d.status.Snapshot(), lines, d.started, time.Nanoseconds(), d.width, d.height)
+	d.out.Write(frame.Bytes())
+}
@@ -0,0 +1,148 @@
+package main
+
+import "bytes"
+import "log"
+import "os"
+import "strings"
+import "testing"
+
+func TestSparkline(t *testing.T) {
+	if got := Sparkline([]float64{0, 7, 3.5, 7}); got != "▁█▄█" {
+		t.Errorf("Unexpected sparkline %s", got)
+	}
+	if got := Sparkline([]float64{5, 5}); got != "▁▁" {
+		t.Errorf("Expected a flat sparkline, got %s", got)
+	}
+}
+
+func TestClip(t *testing.T) {
+	if got := clip("abcdef", 4); got != "abcd" {
+		t.Errorf("Expected abcd, got %s", got)
+	}
+	if got := clip("a▁▂▃▄", 3); got != "a▁▂" {
+		t.Errorf("Expected a▁▂, got %s", got)
+	}
+}
+
+func TestScheduleLine(t *testing.T) {
+	snapshot := &StatusSnapshot{Step: 2, Rate: 200, Schedule: []int{100, 200, 300}}
+	if got := scheduleLine(snapshot, 80); got != "100 [200] 300" {
+		t.Errorf("Unexpected schedule %q", got)
+	}
+	if got := scheduleLine(snapshot, 10); got != "... [200] 300" {
+		t.Errorf("Expected earlier steps but not the current one to be dropped, got %q", got)
+	}
+
+	// A stress test lists the rates it has visited
+	snapshot = &StatusSnapshot{Step: 3, Rate: 300, History: []StepResult{{Step: 1, Rate: 100}, {Step: 2, Rate: 200}}}
+	if got := scheduleLine(snapshot, 80); got != "100 200 [300] ..." {
+		t.Errorf("Unexpected stress schedule %q", got)
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	status := NewStatus()
+	phase := &Phase{Name: "ramp", Mode: "stressconn"}
+	status.SetPhase(phase)
+
+	for step := 1; step <= statusHistory+2; step++ {
+		status.SetStep(phase, step, step*100)
+		status.Record([]*PerfData{
+			&PerfData{Step: step, ArgConnectionRate: step * 50, ConnectionsPerSecond: 40, ReplyTimeResponse: 2, TotalReplies: 10},
+			&PerfData{Step: step, ArgConnectionRate: step * 50, ConnectionsPerSecond: 45, ReplyTimeResponse: 4, TotalReplies: 10},
+		})
+	}
+
+	history := status.Snapshot().History
+	if len(history) != statusHistory {
+		t.Fatalf("Expected %d steps kept, got %d", statusHistory, len(history))
+	}
+	last := history[len(history)-1]
+	if last.Step != statusHistory+2 || last.Rate != (statusHistory+2)*100 || last.Throughput != 85 || last.Latency != 3 {
+		t.Errorf("Unexpected last step %v", last)
+	}
+
+	status.SetPhase(phase)
+	if len(status.Snapshot().History) != 0 {
+		t.Errorf("Expected a new phase to clear the history")
+	}
+}
+
+func TestRenderDashboard(t *testing.T) {
+	snapshot := &StatusSnapshot{
+		Phase:            "ramp",
+		Mode:             "stressconn",
+		Step:             3,
+		Rate:             300,
+		ErrorState:       true,
+		Cooldown:         2,
+		BenchmarkStarted: 10 * 1000000000,
+		BenchmarkLength:  60,
+		Workers:          []WorkerStatus{{Label: "w1", Group: "east", State: "running", Calls: 3}},
+		History:          []StepResult{{Step: 1, Rate: 100, Throughput: 99}, {Step: 2, Rate: 200, Throughput: 180, Errors: 4}},
+	}
+	logLines := []string{"first", "second", "third"}
+
+	buf := new(bytes.Buffer)
+	RenderDashboard(buf, snapshot, logLines, 0, 40*1000000000, 80, 24)
+	out := buf.String()
+
+	expected := []string{
+		"phase ramp (stressconn)  running 0:00:40\n",
+		"Step 3  rate 300  [###############...............] 30s / 60s\n",
+		"Schedule: 100 200 [300] ...\n",
+		"State: ERROR, 2 cooldown steps left\n",
+		"  w1                   east       running",
+		"  Throughput  ▁█                   180.0 conn/s\n",
+		"  Errors      ▁█                   4\n",
+		"\nthird\n",
+	}
+	for _, line := range expected {
+		if strings.Index(out, line) < 0 {
+			t.Errorf("Expected %q in the dashboard, got:\n%s", line, out)
+		}
+	}
+
+	// Only the latest log lines fit in the room left
+	buf = new(bytes.Buffer)
+	RenderDashboard(buf, snapshot, logLines, 0, 40*1000000000, 80, 16)
+	if out := buf.String(); strings.Index(out, "first") >= 0 || strings.Index(out, "third") < 0 {
+		t.Errorf("Expected the earliest log lines to be dropped, got:\n%s", out)
+	}
+}
+
+func TestDashboardLog(t *testing.T) {
+	dashboard := NewDashboard(new(bytes.Buffer), NewStatus())
+	dashboard.Write([]byte("one\n"))
+	dashboard.Write([]byte("two\nthree\n"))
+
+	if len(dashboard.lines) != 3 || dashboard.lines[2] != "three" {
+		t.Errorf("Expected each line of the log to be kept, got %v", dashboard.lines)
+	}
+}
+
+func TestDashboardStop(t *testing.T) {
+	out := new(bytes.Buffer)
+	dashboard := NewDashboard(out, NewStatus())
+	dashboard.Start()
+	defer log.SetOutput(os.Stderr)
+
+	if activeDashboard != dashboard {
+		t.Fatalf("Expected the started dashboard to be the active one")
+	}
+	log.Printf("kept while drawing")
+
+	dashboard.Stop()
+	dashboard.Stop()
+	if activeDashboard != nil {
+		t.Errorf("Expected no active dashboard once stopped")
+	}
+
+	log.Printf("after stopping")
+	text := out.String()
+	kept := strings.LastIndex(text, "kept while drawing\n")
+	after := strings.Index(text, "after stopping\n")
+	if kept < 0 || after < kept {
+		t.Errorf("Expected the kept log replayed and then the log given back, got:\n%s", text)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "log"
+import "math"
+import "net"
+import "os"
+import "reflect"
+import "strconv"
+import "strings"
+
+// A numeric field of a result, as exported to a time-series database
+type exportField struct {
+	Name  string
+	Value float64
+	Int   bool
+}
+
+// The numeric fields of a result, in the order of the CSV columns. Strings
+// and flags are left out, as is the date, which becomes the timestamp, and
+// any value that is not a finite number.
+func exportFields(data *PerfData) []exportField {
+	fields := make([]exportField, 0, len(fieldNames))
+
+	ptr, ok := reflect.NewValue(data).(*reflect.PtrValue)
+	if !ok {
+		fatalf("Could not convert results into a pointer value")
+	}
+
+	val, ok := ptr.Elem().(*reflect.StructValue)
+	if !ok {
+		fatalf("Failed when reflecting on struct")
+	}
+
+	for _, name := range fieldNames {
+		if name == "BenchmarkDate" {
+			continue
+		}
+
+		switch column := val.FieldByName(name).(type) {
+		case *reflect.FloatValue:
+			value := column.Get()
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				fields = append(fields, exportField{name, value, false})
+			}
+		case *reflect.IntValue:
+			fields = append(fields, exportField{name, float64(column.Get()), true})
+		}
+	}
+
+	return fields
+}
+
+func formatExportValue(value float64) string {
+	return strconv.Ftoa64(value, 'g', -1)
+}
+
+// The tags of a result, sorted by name, as "name=value" pairs. Tags with no
+// value are left out.
+func exportTags(data *PerfData) [][2]string {
+	tags := [][2]string{
+		{"benchmark", data.BenchmarkId},
+		{"group", data.WorkerGroup},
+		{"phase", data.Phase},
+		{"rate", strconv.Itoa(data.OfferedLoad())},
+		{"target", data.Target},
+		{"url", data.ArgURL},
+		{"worker", data.WorkerLabel},
+	}
+
+	present := make([][2]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag[1] != "" {
+			present = append(present, tag)
+		}
+	}
+	return present
+}
+
+// Escape a measurement, tag key or tag value of the InfluxDB line protocol
+func influxEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, ",", "\\,", -1)
+	s = strings.Replace(s, "=", "\\=", -1)
+	s = strings.Replace(s, " ", "\\ ", -1)
+	return s
+}
+
+// Write a result as a single point of InfluxDB line protocol, in the
+// 'autohttperf' measurement, tagged by benchmark, worker, URL, rate, phase
+// and target, with a field for each numeric column and a timestamp in
+// nanoseconds. Whole-number columns are written as integer fields.
+func WriteInfluxLine(w io.Writer, data *PerfData) {
+	line := new(bytes.Buffer)
+	line.WriteString("autohttperf")
+
+	for _, tag := range exportTags(data) {
+		fmt.Fprintf(line, ",%s=%s", tag[0], influxEscape(tag[1]))
+	}
+
+	for idx, field := range exportFields(data) {
+		sep := ","
+		if idx == 0 {
+			sep = " "
+		}
+
+		value := formatExportValue(field.Value)
+		if field.Int {
+			value = fmt.Sprintf("%di", int64(field.Value))
+		}
+		fmt.Fprintf(line, "%s%s=%s", sep, field.Name, value)
+	}
+
+	fmt.Fprintf(line, " %d\n", data.BenchmarkDate*1000000000)
+	w.Write(line.Bytes())
+}
+
+// Make a string safe to use as a single node of a Graphite metric path
+func graphiteNode(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	node := []byte(s)
+	for idx, c := range node {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			node[idx] = '_'
+		}
+	}
+	return string(node)
+}
+
+// Write a result as Graphite plaintext, one line for each numeric column.
+// The metric paths are
+//
+//	<prefix>.<phase>.<benchmark>.<worker>.<url>.<rate>.<column>
+//
+// with the timestamp in seconds.
+func WriteGraphiteLines(w io.Writer, data *PerfData) {
+	path := strings.Join([]string{
+		*graphitePrefix,
+		graphiteNode(data.Phase),
+		graphiteNode(data.BenchmarkId),
+		graphiteNode(data.WorkerLabel),
+		graphiteNode(data.ArgURL),
+		"rate_" + strconv.Itoa(data.OfferedLoad()),
+	}, ".")
+
+	lines := new(bytes.Buffer)
+	for _, field := range exportFields(data) {
+		fmt.Fprintf(lines, "%s.%s %s %d\n", path, field.Name, formatExportValue(field.Value), data.BenchmarkDate)
+	}
+	w.Write(lines.Bytes())
+}
+
+// Sends each result, in one of the formats above, to a file or a TCP or UDP
+// endpoint given as tcp://host:port or udp://host:port. Each result is sent
+// as a single write, so over UDP each is a datagram of its own.
+type Exporter struct {
+	Dest   string
+	Format func(io.Writer, *PerfData)
+
+	out    io.WriteCloser
+	opened bool // Whether the destination has been opened before
+}
+
+func NewExporter(dest string, format func(io.Writer, *PerfData)) *Exporter {
+	return &Exporter{Dest: dest, Format: format}
+}
+
+// Open the file or connection. An existing file is truncated the first time
+// it is opened, and appended to when it is reopened after a failed write.
+func (e *Exporter) Open() os.Error {
+	var err os.Error
+
+	if strings.HasPrefix(e.Dest, "tcp://") {
+		e.out, err = net.Dial("tcp", "", e.Dest[len("tcp://"):])
+	} else if strings.HasPrefix(e.Dest, "udp://") {
+		e.out, err = net.Dial("udp", "", e.Dest[len("udp://"):])
+	} else {
+		flag := os.O_WRONLY | os.O_CREAT | os.O_TRUNC
+		if e.opened {
+			flag = os.O_WRONLY | os.O_CREAT | os.O_APPEND
+		}
+		e.out, err = os.Open(e.Dest, flag, 0644)
+	}
+
+	if err != nil {
+		e.out = nil
+		return err
+	}
+	e.opened = true
+	return nil
+}
+
+// Send a set of results, reopening the file or connection if an earlier
+// write failed. Stops at the first error, and closes the connection so the
+// next call will reconnect.
+func (e *Exporter) Export(data []*PerfData) os.Error {
+	if e.out == nil {
+		if err := e.Open(); err != nil {
+			return err
+		}
+	}
+
+	for _, result := range data {
+		buf := new(bytes.Buffer)
+		e.Format(buf, result)
+
+		if _, err := e.out.Write(buf.Bytes()); err != nil {
+			e.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) Close() {
+	if e.out != nil {
+		e.out.Close()
+		e.out = nil
+	}
+}
+
+// The exporters each result is sent to as it is written
+var exporters []*Exporter
+
+// Set up an exporter for each of the -influx and -graphite destinations,
+// opening them now so a bad destination is caught before the run.
+func OpenExporters() os.Error {
+	if *influxDest != "" {
+		exporters = append(exporters, NewExporter(*influxDest, WriteInfluxLine))
+	}
+	if *graphiteDest != "" {
+		exporters = append(exporters, NewExporter(*graphiteDest, WriteGraphiteLines))
+	}
+
+	for _, exporter := range exporters {
+		if err := exporter.Open(); err != nil {
+			return os.NewError(fmt.Sprintf("Could not open %s: %s", exporter.Dest, err.String()))
+		}
+	}
+	return nil
+}
+
+// Send a set of results to every exporter, logging any that fail
+func ExportResults(data []*PerfData) {
+	for _, exporter := range exporters {
+		if err := exporter.Export(data); err != nil {
+			log.Printf("Could not export results to %s: %s", exporter.Dest, err.String())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import "bytes"
+import "io/ioutil"
+import "net"
+import "os"
+import "strings"
+import "testing"
+
+var exportData = &PerfData{
+	BenchmarkId:          "run 1",
+	BenchmarkDate:        1300000000,
+	Phase:                "ramp",
+	Step:                 2,
+	ArgURL:               "/search?q=x",
+	ArgConnectionRate:    150,
+	WorkerLabel:          "w1",
+	ConnectionsPerSecond: 149.5,
+	ErrTotal:             3,
+}
+
+func TestWriteInfluxLine(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteInfluxLine(buf, exportData)
+	line := buf.String()
+
+	prefix := "autohttperf,benchmark=run\\ 1,phase=ramp,rate=150,url=/search?q\\=x,worker=w1 Step=2i,"
+	if !strings.HasPrefix(line, prefix) {
+		t.Errorf("Expected the line to start with %q, got %q", prefix, line)
+	}
+	for _, field := range []string{",ConnectionsPerSecond=149.5,", ",ErrTotal=3,", ",ArgConnectionRate=150i,"} {
+		if strings.Index(line, field) < 0 {
+			t.Errorf("Expected %q in %q", field, line)
+		}
+	}
+	if !strings.HasSuffix(line, " 1300000000000000000\n") {
+		t.Errorf("Expected a timestamp in nanoseconds, got %q", line)
+	}
+	if strings.Index(line, "BenchmarkDate") >= 0 || strings.Index(line, "Warmup") >= 0 {
+		t.Errorf("Expected only numeric fields, got %q", line)
+	}
+}
+
+func TestWriteGraphiteLines(t *testing.T) {
+	buf := new(bytes.Buffer)
+	WriteGraphiteLines(buf, exportData)
+	out := buf.String()
+
+	line := "autohttperf.ramp.run_1.w1._search_q_x.rate_150.ConnectionsPerSecond 149.5 1300000000\n"
+	if strings.Index(out, line) < 0 {
+		t.Errorf("Expected %q in:\n%s", line, out)
+	}
+	if lines := strings.Count(out, "\n"); lines != len(exportFields(exportData)) {
+		t.Errorf("Expected a line for each of %d fields, got %d", len(exportFields(exportData)), lines)
+	}
+}
+
+func TestExportTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err.String())
+	}
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		contents, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		received <- string(contents)
+	}()
+
+	exporter := NewExporter("tcp://"+listener.Addr().String(), WriteGraphiteLines)
+	if err := exporter.Export([]*PerfData{exportData, exportData}); err != nil {
+		t.Fatalf("Could not export: %s", err.String())
+	}
+	exporter.Close()
+
+	buf := new(bytes.Buffer)
+	WriteGraphiteLines(buf, exportData)
+	if got := <-received; got != buf.String()+buf.String() {
+		t.Errorf("Expected both results over TCP, got:\n%s", got)
+	}
+}
+
+func TestExportUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err.String())
+	}
+	defer conn.Close()
+
+	exporter := NewExporter("udp://"+conn.LocalAddr().String(), WriteInfluxLine)
+	defer exporter.Close()
+	if err := exporter.Export([]*PerfData{exportData}); err != nil {
+		t.Fatalf("Could not export: %s", err.String())
+	}
+
+	packet := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(packet)
+	if err != nil {
+		t.Fatalf("Could not read the datagram: %s", err.String())
+	}
+
+	buf := new(bytes.Buffer)
+	WriteInfluxLine(buf, exportData)
+	if string(packet[:n]) != buf.String() {
+		t.Errorf("Expected the result as a single datagram, got %q", packet[:n])
+	}
+}
+
+func TestExportFileReopen(t *testing.T) {
+	file, err := ioutil.TempFile("", "autohttperf-export")
+	if err != nil {
+		t.Fatalf("Could not create a file: %s", err.String())
+	}
+	filename := file.Name()
+	file.WriteString("left over from an earlier run\n")
+	file.Close()
+	defer os.Remove(filename)
+
+	// Closing the exporter stands in for a failed write, after which the
+	// next export reopens the file
+	exporter := NewExporter(filename, WriteInfluxLine)
+	if err := exporter.Open(); err != nil {
+		t.Fatalf("Could not open: %s", err.String())
+	}
+	if err := exporter.Export([]*PerfData{exportData}); err != nil {
+		t.Fatalf("Could not export: %s", err.String())
+	}
+	exporter.Close()
+	if err := exporter.Export([]*PerfData{exportData}); err != nil {
+		t.Fatalf("Could not export after reopening: %s", err.String())
+	}
+	exporter.Close()
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Could not read the file: %s", err.String())
+	}
+
+	buf := new(bytes.Buffer)
+	WriteInfluxLine(buf, exportData)
+	if string(contents) != buf.String()+buf.String() {
+		t.Errorf("Expected the file to be truncated once and then appended to, got:\n%s", contents)
+	}
+}
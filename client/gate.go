@@ -0,0 +1,122 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "log"
+import "os"
+import "strings"
+
+// The number of distributed benchmarks so far that did not fully succeed
+var failedBenchmarks int
+
+// Compare a set of results against a baseline results file
+func CheckBaseline(data []*PerfData, filename string, thresholds []Threshold) ([]*MetricDelta, os.Error) {
+	base, err := ReadTSVParseDataFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := CompareResults(base, data, thresholds)
+	if len(deltas) == 0 {
+		return nil, os.NewError(fmt.Sprintf("The results have no phases and rates in common with %s", filename))
+	}
+
+	return deltas, nil
+}
+
+// Escape a string for use in XML text or attribute values
+func xmlEscape(s string) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, "<", "&lt;", -1)
+	s = strings.Replace(s, ">", "&gt;", -1)
+	s = strings.Replace(s, "\"", "&quot;", -1)
+	s = strings.Replace(s, "'", "&apos;", -1)
+	return s
+}
+
+// Write a JUnit XML report with a test case for every benchmark having
+// succeeded, and one for each metric compared against the baseline.
+func WriteJUnit(w io.Writer, deltas []*MetricDelta, failed int) {
+	failures := CountRegressions(deltas)
+	if failed > 0 {
+		failures++
+	}
+
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<testsuite name=\"autohttperf\" tests=\"%d\" failures=\"%d\" errors=\"0\">\n", len(deltas)+1, failures)
+
+	fmt.Fprintf(w, "  <testcase classname=\"autohttperf\" name=\"benchmarks completed\">\n")
+	if failed > 0 {
+		fmt.Fprintf(w, "    <failure message=\"%d benchmarks did not fully succeed\"></failure>\n", failed)
+	}
+	fmt.Fprintf(w, "  </testcase>\n")
+
+	for _, delta := range deltas {
+		classname := "autohttperf." + delta.Phase
+		if delta.Target != "" {
+			classname += "." + delta.Target
+		}
+		name := fmt.Sprintf("%s at %s", delta.Metric, delta.Where())
+
+		fmt.Fprintf(w, "  <testcase classname=\"%s\" name=\"%s\">\n", xmlEscape(classname), xmlEscape(name))
+		if delta.Regression {
+			message := fmt.Sprintf("%s changed from %.1f to %.1f (%+.1f%%), beyond %s",
+				delta.Metric, delta.Base, delta.Current, delta.PercentChange(), delta.Threshold)
+			fmt.Fprintf(w, "    <failure message=\"%s\"></failure>\n", xmlEscape(message))
+		}
+		fmt.Fprintf(w, "    <system-out>baseline %.3f current %.3f</system-out>\n", delta.Base, delta.Current)
+		fmt.Fprintf(w, "  </testcase>\n")
+	}
+
+	fmt.Fprintf(w, "</testsuite>\n")
+}
+
+func writeJUnitFile(filename string, deltas []*MetricDelta, failed int) os.Error {
+	buf := new(bytes.Buffer)
+	WriteJUnit(buf, deltas, failed)
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// Decide whether a run passed, comparing its results against the -baseline
+// if one was given, and writing the -junit report if requested. Returns the
+// status the process should exit with: 0 if every benchmark succeeded and
+// nothing regressed, or 1 otherwise.
+func RunGate(data []*PerfData) int {
+	status := 0
+
+	if failedBenchmarks > 0 {
+		log.Printf("%d benchmarks did not fully succeed", failedBenchmarks)
+		status = 1
+	}
+
+	var deltas []*MetricDelta
+
+	if *baseline != "" {
+		thresholds, err := ParseThresholds(*thresholdSpec)
+		if err == nil {
+			deltas, err = CheckBaseline(data, *baseline, thresholds)
+		}
+
+		if err != nil {
+			log.Printf("Could not compare against the baseline: %s", err.String())
+			status = 1
+		} else if regressions := CountRegressions(deltas); regressions > 0 {
+			LogRegressions(deltas)
+			log.Printf("%d of %d metrics regressed from the baseline", regressions, len(deltas))
+			status = 1
+		} else {
+			log.Printf("No regressions from the baseline in %d metrics", len(deltas))
+		}
+	}
+
+	if *junit != "" {
+		if err := writeJUnitFile(*junit, deltas, failedBenchmarks); err != nil {
+			log.Printf("Could not write the JUnit report: %s", err.String())
+			status = 1
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,38 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestXMLEscape(t *testing.T) {
+	escaped := xmlEscape(`<a href="x">'b' & c</a>`)
+	expected := "&lt;a href=&quot;x&quot;&gt;&apos;b&apos; &amp; c&lt;/a&gt;"
+	if escaped != expected {
+		t.Errorf("Expected %s, got %s", expected, escaped)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	deltas := []*MetricDelta{
+		&MetricDelta{Phase: "ramp", Rate: 100, Metric: "Throughput", Base: 100, Current: 99},
+		&MetricDelta{Phase: "ramp", Rate: 200, Metric: "Latency", Base: 10, Current: 20,
+			Regression: true, Threshold: "Latency=+10%"},
+	}
+
+	buf := new(bytes.Buffer)
+	WriteJUnit(buf, deltas, 1)
+	report := buf.String()
+
+	if strings.Index(report, `tests="3" failures="2"`) < 0 {
+		t.Errorf("Expected 3 tests and 2 failures in the report:\n%s", report)
+	}
+	if strings.Count(report, "<testcase ") != 3 {
+		t.Errorf("Expected 3 test cases in the report:\n%s", report)
+	}
+	if strings.Index(report, `name="Latency at rate 200"`) < 0 {
+		t.Errorf("Expected a test case for the latency at rate 200:\n%s", report)
+	}
+	if strings.Count(report, "<failure ") != 2 {
+		t.Errorf("Expected 2 failures in the report:\n%s", report)
+	}
+}
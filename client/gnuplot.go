@@ -0,0 +1,206 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "log"
+import "os"
+import "strings"
+
+// The columns of each gnuplot data file, in order
+var gnuplotColumns = []string{"Rate", "RepliesPerSecond", "ConnectionTimeMin", "ConnectionTimeAvg",
+	"ConnectionTimeMedian", "ConnectionTimeMax", "Errors", "ConnectionsPerSecond", "ReplyTimeResponse"}
+
+// A series of points for gnuplot, with a row of the columns above for each
+type plotSeries struct {
+	Name string
+	Rows [][]float64
+}
+
+func plotRow(x float64, d *PerfData) []float64 {
+	return []float64{x, d.RepliesPerSecAvg, d.ConnectionTimeMin, d.ConnectionTimeAvg,
+		d.ConnectionTimeMedian, d.ConnectionTimeMax, d.ErrTotal, d.ConnectionsPerSecond, d.ReplyTimeResponse}
+}
+
+// Build the series to plot from a set of results: one for each phase (and
+// target) with its workers combined, or one for each worker of each phase.
+// Either way the X value is the total offered rate of each step, or the step
+// number if the rate doesn't change. Returns the label of the X axis too.
+func GnuplotSeries(data []*PerfData, perWorker bool) ([]*plotSeries, string) {
+	all := make([]*plotSeries, 0)
+	xlabel := "Offered rate (conn/s, or clients)"
+
+	for idx, series := range buildReportSeries(data) {
+		name := series.Phase
+		if series.Target != "" {
+			name += " " + series.Target
+		}
+		if idx == 0 {
+			xlabel = series.xLabel()
+		}
+
+		// Plot the points in order along the X axis
+		steps := make(reportSteps, len(series.Steps))
+		copy(steps, series.Steps)
+		if series.ByLoad {
+			SortByLoad(steps)
+		}
+
+		if !perWorker {
+			plot := &plotSeries{Name: name}
+			for _, step := range steps {
+				plot.Rows = append(plot.Rows, plotRow(series.x(step), step.Agg))
+			}
+			all = append(all, plot)
+			continue
+		}
+
+		workers := make(map[string]*plotSeries)
+		for _, step := range steps {
+			for _, perfdata := range step.Workers {
+				plot, ok := workers[perfdata.WorkerLabel]
+				if !ok {
+					plot = &plotSeries{Name: name + " " + perfdata.WorkerLabel}
+					workers[perfdata.WorkerLabel] = plot
+					all = append(all, plot)
+				}
+				plot.Rows = append(plot.Rows, plotRow(series.x(step), perfdata))
+			}
+		}
+	}
+
+	return all, xlabel
+}
+
+// Write the series as a gnuplot data file, each as its own data block so it
+// can be selected with 'index'.
+func WriteGnuplotData(w io.Writer, series []*plotSeries) {
+	fmt.Fprintf(w, "# %s\n", strings.Join(gnuplotColumns, " "))
+
+	for idx, plot := range series {
+		if idx > 0 {
+			fmt.Fprintf(w, "\n\n")
+		}
+		fmt.Fprintf(w, "# %d: %s\n", idx, plot.Name)
+
+		for _, row := range plot.Rows {
+			values := make([]string, len(row))
+			for col, value := range row {
+				values[col] = fmt.Sprintf("%g", value)
+			}
+			fmt.Fprintf(w, "%s\n", strings.Join(values, " "))
+		}
+	}
+}
+
+// Quote a string for gnuplot
+func gnuplotQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Write a gnuplot script that plots the data file as PNG images: replies per
+// second, connection time and errors against the rate. Each image is named
+// after the prefix.
+func WriteGnuplotScript(w io.Writer, series []*plotSeries, datafile string, prefix string, xlabel string) {
+	fmt.Fprintf(w, "# Plots %s, run with: gnuplot %s.gp\n", datafile, prefix)
+	fmt.Fprintf(w, "set terminal png size 900,540\n")
+	fmt.Fprintf(w, "set grid\n")
+	fmt.Fprintf(w, "set key outside right\n")
+	fmt.Fprintf(w, "set xlabel %s\n", gnuplotQuote(xlabel))
+	fmt.Fprintf(w, "set yrange [0:*]\n")
+
+	plot := func(name string, title string, ylabel string, columns []int, suffixes []string) {
+		fmt.Fprintf(w, "\nset output %s\n", gnuplotQuote(prefix+"-"+name+".png"))
+		fmt.Fprintf(w, "set title %s\n", gnuplotQuote(title))
+		fmt.Fprintf(w, "set ylabel %s\n", gnuplotQuote(ylabel))
+
+		lines := make([]string, 0)
+		for idx, s := range series {
+			for cidx, column := range columns {
+				lines = append(lines, fmt.Sprintf("%s index %d using 1:%d with linespoints title %s",
+					gnuplotQuote(datafile), idx, column, gnuplotQuote(s.Name+suffixes[cidx])))
+			}
+		}
+		fmt.Fprintf(w, "plot %s\n", strings.Join(lines, ", \\\n     "))
+	}
+
+	plot("replies", "Replies per second", "replies/s", []int{2}, []string{""})
+
+	// The full spread of connection times is only readable for one series
+	if len(series) == 1 {
+		plot("conntime", "Connection time", "ms", []int{3, 4, 5, 6}, []string{" min", " avg", " median", " max"})
+	} else {
+		plot("conntime", "Median connection time", "ms", []int{5}, []string{""})
+	}
+
+	plot("errors", "Errors", "errors", []int{7}, []string{""})
+}
+
+// Write prefix.dat and prefix.gp for a set of results
+func writeGnuplotFiles(prefix string, data []*PerfData, perWorker bool) os.Error {
+	series, xlabel := GnuplotSeries(data, perWorker)
+
+	// The script refers to the data file relative to itself
+	datafile := prefix + ".dat"
+	if sep := strings.LastIndex(datafile, "/"); sep >= 0 {
+		datafile = datafile[sep+1:]
+	}
+	name := prefix
+	if sep := strings.LastIndex(name, "/"); sep >= 0 {
+		name = name[sep+1:]
+	}
+
+	buf := new(bytes.Buffer)
+	WriteGnuplotData(buf, series)
+	if err := ioutil.WriteFile(prefix+".dat", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	buf = new(bytes.Buffer)
+	WriteGnuplotScript(buf, series, datafile, name, xlabel)
+	if err := ioutil.WriteFile(prefix+".gp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %s.dat and %s.gp", prefix, prefix)
+	return nil
+}
+
+// Prefix the phase of each result with the name of the file it was read
+// from, so that runs in different files with the same phases are plotted as
+// series of their own rather than combined.
+func labelByFile(data []*PerfData, filename string) {
+	name := filename
+	if sep := strings.LastIndex(name, "/"); sep >= 0 {
+		name = name[sep+1:]
+	}
+	for _, perfdata := range data {
+		perfdata.Phase = name + " " + perfdata.Phase
+	}
+}
+
+// The 'plot' subcommand, which writes the gnuplot files for stored results
+func RunPlot(filenames []string) os.Error {
+	if len(filenames) == 0 {
+		return os.NewError("No result files given to plot")
+	}
+
+	data := make([]*PerfData, 0)
+	for _, filename := range filenames {
+		results, err := ReadTSVParseDataFile(filename)
+		if err != nil {
+			return err
+		}
+		if len(filenames) > 1 {
+			labelByFile(results, filename)
+		}
+		data = append(data, results...)
+	}
+
+	prefix := *gnuplotPrefix
+	if prefix == "" {
+		prefix = "autohttperf"
+	}
+	return writeGnuplotFiles(prefix, data, *gnuplotWorkers)
+}
@@ -0,0 +1,111 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+var plotData = []*PerfData{
+	&PerfData{Phase: "ramp", Step: 2, ArgConnectionRate: 100, WorkerLabel: "w1", RepliesPerSecAvg: 480, ErrTotal: 1},
+	&PerfData{Phase: "ramp", Step: 2, ArgConnectionRate: 100, WorkerLabel: "w2", RepliesPerSecAvg: 470},
+	&PerfData{Phase: "ramp", Step: 1, ArgConnectionRate: 50, WorkerLabel: "w1", RepliesPerSecAvg: 250},
+	&PerfData{Phase: "ramp", Step: 1, ArgConnectionRate: 50, WorkerLabel: "w2", RepliesPerSecAvg: 250},
+}
+
+func TestGnuplotSeries(t *testing.T) {
+	series, _ := GnuplotSeries(plotData, false)
+	if len(series) != 1 {
+		t.Fatalf("Expected 1 combined series, got %d", len(series))
+	}
+
+	rows := series[0].Rows
+	if len(rows) != 2 || rows[0][0] != 100 || rows[1][0] != 200 {
+		t.Fatalf("Expected rates 100 and 200 in order, got %v", rows)
+	}
+	if rows[1][1] != 950 || rows[1][6] != 1 {
+		t.Errorf("Expected 950 replies/s and 1 error at rate 200, got %v", rows[1])
+	}
+
+	series, _ = GnuplotSeries(plotData, true)
+	if len(series) != 2 {
+		t.Fatalf("Expected a series for each of 2 workers, got %d", len(series))
+	}
+	if series[0].Name != "ramp w1" || len(series[0].Rows) != 2 || series[0].Rows[1][1] != 480 {
+		t.Errorf("Unexpected series for the first worker: %s %v", series[0].Name, series[0].Rows)
+	}
+}
+
+func TestGnuplotSeriesTrials(t *testing.T) {
+	data := []*PerfData{
+		&PerfData{Phase: "ramp", Step: 1, Trial: 1, ArgConnectionRate: 50, WorkerLabel: "w1", RepliesPerSecAvg: 240, RepliesPerSecMax: 260, ConnectionsPerSecond: 48},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 1, ArgConnectionRate: 50, WorkerLabel: "w2", RepliesPerSecAvg: 250, RepliesPerSecMax: 270, ConnectionsPerSecond: 50},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 2, ArgConnectionRate: 50, WorkerLabel: "w1", RepliesPerSecAvg: 260, RepliesPerSecMax: 280, ConnectionsPerSecond: 50},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 2, ArgConnectionRate: 50, WorkerLabel: "w2", RepliesPerSecAvg: 250, RepliesPerSecMax: 290, ConnectionsPerSecond: 52},
+	}
+
+	series, _ := GnuplotSeries(data, false)
+	if len(series) != 1 || len(series[0].Rows) != 1 {
+		t.Fatalf("Expected a single point for the repeated step, got %v", series)
+	}
+
+	// The trials are averaged, while the workers of each trial are summed
+	row := series[0].Rows[0]
+	if row[0] != 100 {
+		t.Errorf("Expected the rate of a single trial, 100, got %g", row[0])
+	}
+	if row[1] != 500 {
+		t.Errorf("Expected 500 replies/s, the mean of the trials, got %g", row[1])
+	}
+	if row[7] != 100 {
+		t.Errorf("Expected 100 conn/s, the mean of the trials, got %g", row[7])
+	}
+}
+
+func TestGnuplotSeriesByFile(t *testing.T) {
+	data := make([]*PerfData, 0)
+	for _, filename := range []string{"results/before.csv", "after.csv"} {
+		results := make([]*PerfData, len(plotData))
+		for idx, perfdata := range plotData {
+			copied := *perfdata
+			results[idx] = &copied
+		}
+		labelByFile(results, filename)
+		data = append(data, results...)
+	}
+
+	series, _ := GnuplotSeries(data, false)
+	if len(series) != 2 {
+		t.Fatalf("Expected a series for each of 2 files, got %d", len(series))
+	}
+	if series[0].Name != "before.csv ramp" || series[1].Name != "after.csv ramp" {
+		t.Errorf("Expected series named after their files, got '%s' and '%s'", series[0].Name, series[1].Name)
+	}
+	if rows := series[1].Rows; len(rows) != 2 || rows[1][1] != 950 {
+		t.Errorf("Expected the files not to be summed, got %v", rows)
+	}
+}
+
+func TestWriteGnuplot(t *testing.T) {
+	series, xlabel := GnuplotSeries(plotData, true)
+
+	buf := new(bytes.Buffer)
+	WriteGnuplotData(buf, series)
+	if blocks := strings.Count(buf.String(), "\n\n\n"); blocks != 1 {
+		t.Errorf("Expected 2 data blocks separated by two blank lines, got %d separators", blocks)
+	}
+
+	buf = new(bytes.Buffer)
+	WriteGnuplotScript(buf, series, "run.dat", "run", xlabel)
+	script := buf.String()
+
+	for _, output := range []string{"'run-replies.png'", "'run-conntime.png'", "'run-errors.png'"} {
+		if strings.Index(script, output) < 0 {
+			t.Errorf("Expected the script to write %s", output)
+		}
+	}
+	if strings.Index(script, "'run.dat' index 1 using 1:2") < 0 {
+		t.Errorf("Expected the script to plot the second series:\n%s", script)
+	}
+	if gnuplotQuote("it's") != "'it''s'" {
+		t.Errorf("Expected quotes to be doubled, got %s", gnuplotQuote("it's"))
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import "fmt"
+import "log"
+import "os"
+import "sort"
+import "strings"
+
+// A workload for a group of workers. Any of the target fields that are left
+// empty fall back to the arguments of the benchmark as a whole.
+type GroupSpec struct {
+	Name  string  // The group name, matching the Group of inventory entries
+	Host  string  // The server this group benchmarks
+	Port  int     // The port this group benchmarks
+	URL   string  // The URL this group requests
+	Share float64 // The fraction of the total connections and rate
+}
+
+// Apply the overrides of the group workload to a worker's arguments
+func (g *GroupSpec) Apply(args *Args) {
+	if g.Host != "" {
+		args.Host = g.Host
+	}
+	if g.Port != 0 {
+		args.Port = g.Port
+	}
+	if g.URL != "" {
+		args.URL = g.URL
+		args.WorkLog = nil
+	}
+}
+
+// Attach the workload of each group to its member workers. Returns an error
+// if a workload names a group that has no workers.
+func AssignGroups(workers []*Worker, specs []GroupSpec) os.Error {
+	for idx := range specs {
+		spec := &specs[idx]
+		members := 0
+
+		for _, worker := range workers {
+			if worker.group == spec.Name {
+				worker.workload = spec
+				members++
+			}
+		}
+
+		if members == 0 {
+			return os.NewError(fmt.Sprintf("Group workload '%s' has no workers", spec.Name))
+		}
+
+		log.Printf("Group %s: %d workers, host %q, port %d, URL %q, share %.2f",
+			spec.Name, members, spec.Host, spec.Port, spec.URL, spec.Share)
+	}
+
+	return nil
+}
+
+// Work out the share of the benchmark that each worker takes. Groups with a
+// workload share split it between their members by weight, and all other
+// workers split whatever is left over by weight. If every worker belongs to
+// a group with a share, the shares are normalised to add up to one.
+func WorkerShares(workers []*Worker) []float64 {
+	shares := make([]float64, len(workers))
+
+	groupShare := 0.0
+	groupWeights := make(map[*GroupSpec]float64)
+	otherWeight := 0.0
+
+	for _, worker := range workers {
+		if worker.workload != nil && worker.workload.Share > 0 {
+			if _, ok := groupWeights[worker.workload]; !ok {
+				groupShare += worker.workload.Share
+			}
+			groupWeights[worker.workload] += worker.weight
+		} else {
+			otherWeight += worker.weight
+		}
+	}
+
+	// Normalise the group shares if they are over-committed, or if there
+	// are no other workers to take up the remainder.
+	scale := 1.0
+	if groupShare > 1 || (otherWeight == 0 && groupShare > 0) {
+		scale = 1 / groupShare
+	}
+	remaining := 1 - groupShare*scale
+
+	for idx, worker := range workers {
+		if worker.workload != nil && worker.workload.Share > 0 {
+			spec := worker.workload
+			shares[idx] = spec.Share * scale * worker.weight / groupWeights[spec]
+		} else if otherWeight > 0 {
+			shares[idx] = remaining * worker.weight / otherWeight
+		}
+	}
+
+	return shares
+}
+
+// Log a summary of the results for each group of workers, followed by the
+// combined results of every worker.
+func ReportGroups(data []*PerfData) {
+	groups := make(map[string][]*PerfData)
+	names := make([]string, 0, len(data))
+
+	for _, perfdata := range data {
+		if _, ok := groups[perfdata.WorkerGroup]; !ok {
+			names = append(names, perfdata.WorkerGroup)
+		}
+		groups[perfdata.WorkerGroup] = append(groups[perfdata.WorkerGroup], perfdata)
+	}
+
+	if len(names) > 1 {
+		sort.SortStrings(names)
+		for _, name := range names {
+			label := name
+			if label == "" {
+				label = "(none)"
+			}
+			log.Printf("Group %s: %s", label, summarisePerfData(groups[name]))
+		}
+	}
+
+	if len(data) > 0 {
+		log.Printf("Combined: %s", summarisePerfData(data))
+	}
+}
+
+// A one line summary of the aggregate of a set of results
+func summarisePerfData(data []*PerfData) string {
+	agg := AggregatePerfData(data)
+
+	targets := make([]string, 0, len(data))
+	seen := make(map[string]bool)
+	for _, perfdata := range data {
+		target := fmt.Sprintf("%s:%d%s", perfdata.ArgHost, perfdata.ArgPort, perfdata.ArgURL)
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	return fmt.Sprintf("%d workers, %s, rate %d, %.1f conn/s, %.1f replies/s, response %.1f ms, %.0f errors",
+		len(data), strings.Join(targets, " "), agg.ArgConnectionRate, agg.ConnectionsPerSecond,
+		agg.RepliesPerSecAvg, agg.ReplyTimeResponse, agg.ErrTotal)
+}
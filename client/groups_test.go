@@ -0,0 +1,62 @@
+package main
+
+import "math"
+import "testing"
+
+var apiGroup = &GroupSpec{Name: "api", Share: 0.6}
+var staticGroup = &GroupSpec{Name: "static", Share: 0.2}
+var greedyGroup = &GroupSpec{Name: "greedy", Share: 0.8}
+
+var shareTests = []struct {
+	name     string
+	workers  []*Worker
+	expected []float64
+}{
+	{
+		"equal weights",
+		[]*Worker{&Worker{weight: 1}, &Worker{weight: 1}},
+		[]float64{0.5, 0.5},
+	},
+	{
+		"uneven weights",
+		[]*Worker{&Worker{weight: 1}, &Worker{weight: 3}},
+		[]float64{0.25, 0.75},
+	},
+	{
+		"a group share and the rest",
+		[]*Worker{&Worker{weight: 1, workload: apiGroup}, &Worker{weight: 2, workload: apiGroup}, &Worker{weight: 1}},
+		[]float64{0.2, 0.4, 0.4},
+	},
+	{
+		"every worker in a group",
+		[]*Worker{&Worker{weight: 1, workload: apiGroup}, &Worker{weight: 1, workload: staticGroup}},
+		[]float64{0.75, 0.25},
+	},
+	{
+		"over-committed groups",
+		[]*Worker{&Worker{weight: 1, workload: greedyGroup}, &Worker{weight: 1, workload: apiGroup}, &Worker{weight: 1}},
+		[]float64{8.0 / 14, 6.0 / 14, 0},
+	},
+	{
+		"a group without a share",
+		[]*Worker{&Worker{weight: 1, workload: &GroupSpec{Name: "any"}}, &Worker{weight: 1}},
+		[]float64{0.5, 0.5},
+	},
+}
+
+func TestWorkerShares(t *testing.T) {
+	for _, test := range shareTests {
+		shares := WorkerShares(test.workers)
+
+		if len(shares) != len(test.expected) {
+			t.Errorf("%s: expected %d shares, got %d", test.name, len(test.expected), len(shares))
+			continue
+		}
+		for idx, share := range shares {
+			if math.Abs(share-test.expected[idx]) > 1e-9 {
+				t.Errorf("%s: expected shares %v, got %v", test.name, test.expected, shares)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "fmt"
+import "io/ioutil"
+import "json"
+import "os"
+import "rpc"
+import "strings"
+
+// A single worker listed in an inventory file
+type InventoryEntry struct {
+	Address string  // The host:port of the worker daemon
+	Label   string  // A human readable name, defaults to the worker id
+	Weight  float64 // The relative share of each benchmark, defaults to 1
+	Group   string  // A group such as a rack or region
+	Notes   string  // Free-form notes, not used by the benchmark
+}
+
+// An inventory file is a JSON object listing the workers, and optionally a
+// workload for some of the groups, e.g.
+//
+//	{"Workers": [
+//		{"Address": "worker1:1717", "Label": "w1", "Group": "api", "Weight": 2},
+//		{"Address": "worker2:1717", "Label": "w2", "Group": "static"}
+//	],
+//	"Groups": [
+//		{"Name": "api", "URL": "/api", "Share": 0.6},
+//		{"Name": "static", "URL": "/static/logo.png", "Share": 0.4}
+//	]}
+type Inventory struct {
+	Workers []InventoryEntry
+	Groups  []GroupSpec
+}
+
+// Load and validate an inventory file
+func LoadInventory(filename string) (*Inventory, os.Error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := new(Inventory)
+	if err := json.Unmarshal(contents, inv); err != nil {
+		return nil, os.NewError(fmt.Sprintf("Error parsing %s: %s", filename, err.String()))
+	}
+
+	for idx, entry := range inv.Workers {
+		if entry.Address == "" {
+			return nil, os.NewError(fmt.Sprintf("Worker %d in %s has no address", idx, filename))
+		}
+		if entry.Weight < 0 {
+			return nil, os.NewError(fmt.Sprintf("Worker %s has a negative weight", entry.Address))
+		}
+
+		// Labels and groups are written into the CSV output as-is
+		if strings.Index(entry.Label, ",") >= 0 || strings.Index(entry.Group, ",") >= 0 {
+			return nil, os.NewError(fmt.Sprintf("Worker %s has a comma in its label or group", entry.Address))
+		}
+	}
+
+	for _, spec := range inv.Groups {
+		if spec.Name == "" {
+			return nil, os.NewError(fmt.Sprintf("Group workload in %s has no name", filename))
+		}
+		if spec.Share < 0 {
+			return nil, os.NewError(fmt.Sprintf("Group %s has a negative share", spec.Name))
+		}
+		if strings.Index(spec.URL, ",") >= 0 || strings.Index(spec.Host, ",") >= 0 {
+			return nil, os.NewError(fmt.Sprintf("Group %s has a comma in its host or URL", spec.Name))
+		}
+	}
+
+	return inv, nil
+}
+
+// Create a worker from an inventory entry, filling in the defaults for any
+// fields that were not supplied.
+func NewWorker(id string, client *rpc.Client, entry InventoryEntry) *Worker {
+	worker := &Worker{
+		addr:   entry.Address,
+		id:     id,
+		client: client,
+		label:  entry.Label,
+		group:  entry.Group,
+		weight: entry.Weight,
+		notes:  entry.Notes,
+	}
+
+	if worker.label == "" {
+		worker.label = id
+	}
+	if worker.weight == 0 {
+		worker.weight = 1
+	}
+
+	return worker
+}
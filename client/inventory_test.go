@@ -0,0 +1,64 @@
+package main
+
+import "io/ioutil"
+import "os"
+import "testing"
+
+var inventoryTests = []struct {
+	name     string
+	contents string
+	ok       bool
+}{
+	{"workers and groups", `{"Workers": [{"Address": "worker1:1717", "Label": "w1", "Group": "api", "Weight": 2},
+		{"Address": "worker2:1717"}], "Groups": [{"Name": "api", "URL": "/api", "Share": 0.6}]}`, true},
+	{"invalid JSON", `{"Workers": [`, false},
+	{"no address", `{"Workers": [{"Label": "w1"}]}`, false},
+	{"negative weight", `{"Workers": [{"Address": "worker1:1717", "Weight": -1}]}`, false},
+	{"comma in a label", `{"Workers": [{"Address": "worker1:1717", "Label": "a,b"}]}`, false},
+	{"comma in a group", `{"Workers": [{"Address": "worker1:1717", "Group": "a,b"}]}`, false},
+	{"group without a name", `{"Workers": [{"Address": "worker1:1717"}], "Groups": [{"Share": 0.5}]}`, false},
+	{"negative share", `{"Workers": [{"Address": "worker1:1717"}], "Groups": [{"Name": "api", "Share": -0.5}]}`, false},
+	{"comma in a URL", `{"Workers": [{"Address": "worker1:1717"}], "Groups": [{"Name": "api", "URL": "/a,b"}]}`, false},
+}
+
+func TestLoadInventory(t *testing.T) {
+	for _, test := range inventoryTests {
+		file, err := ioutil.TempFile("", "autohttperf-inventory")
+		if err != nil {
+			t.Fatalf("Could not create a file: %s", err.String())
+		}
+		file.WriteString(test.contents)
+		file.Close()
+
+		inv, err := LoadInventory(file.Name())
+		os.Remove(file.Name())
+
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.String())
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if err != nil || !test.ok {
+			continue
+		}
+
+		if len(inv.Workers) != 2 || inv.Workers[0].Label != "w1" || inv.Workers[0].Weight != 2 {
+			t.Errorf("%s: unexpected workers %v", test.name, inv.Workers)
+		}
+		if len(inv.Groups) != 1 || inv.Groups[0].URL != "/api" || inv.Groups[0].Share != 0.6 {
+			t.Errorf("%s: unexpected groups %v", test.name, inv.Groups)
+		}
+	}
+}
+
+func TestNewWorker(t *testing.T) {
+	worker := NewWorker("worker1:1717", nil, InventoryEntry{Address: "worker1:1717"})
+	if worker.label != "worker1:1717" || worker.weight != 1 {
+		t.Errorf("Expected the label and weight to default, got '%s' and %g", worker.label, worker.weight)
+	}
+
+	worker = NewWorker("worker2:1717", nil, InventoryEntry{Address: "worker2:1717", Label: "w2", Weight: 3})
+	if worker.label != "w2" || worker.weight != 3 {
+		t.Errorf("Expected the given label and weight, got '%s' and %g", worker.label, worker.weight)
+	}
+}
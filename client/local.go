@@ -0,0 +1,118 @@
+package main
+
+import "exec"
+import "fmt"
+import "log"
+import "net"
+import "os"
+import "time"
+
+// Worker daemons started by the coordinator itself, so that a distributed
+// benchmark can be run on a single machine with one command.
+var localDaemons []*exec.Cmd
+
+// How long to wait for a local worker to start accepting connections, in
+// nanoseconds, and how often to check.
+const localStartTimeout = 10 * 1000000000
+const localStartPoll = 100 * 1000000
+
+// Start a number of worker daemons as child processes bound to the loopback
+// interface, on consecutive ports. Returns the addresses of the workers once
+// they are all accepting connections.
+func StartLocalWorkers(count int) ([]string, os.Error) {
+	daemon, err := exec.LookPath(*localDaemon)
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("Could not find the worker daemon '%s': %s", *localDaemon, err.String()))
+	}
+
+	addrs := make([]string, 0, count)
+
+	for idx := 0; idx < count; idx++ {
+		port := *localPort + idx
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+		argv := []string{
+			daemon,
+			"-host", "127.0.0.1",
+			"-port", fmt.Sprintf("%d", port),
+		}
+
+		// A daemon already listening there would be mistaken for ours
+		if conn, err := net.Dial("tcp", "", addr); err == nil {
+			conn.Close()
+			StopLocalWorkers()
+			return nil, os.NewError(fmt.Sprintf("Something is already listening on %s, try another -localport", addr))
+		}
+
+		log.Printf("Starting local worker on %s", addr)
+		cmd, err := exec.Run(argv[0], argv, nil, "", exec.DevNull, exec.PassThrough, exec.PassThrough)
+		if err != nil {
+			StopLocalWorkers()
+			return nil, os.NewError(fmt.Sprintf("Could not start local worker on %s: %s", addr, err.String()))
+		}
+
+		localDaemons = append(localDaemons, cmd)
+		addrs = append(addrs, addr)
+	}
+
+	for idx, addr := range addrs {
+		if err := waitForListener(addr, localDaemons[idx]); err != nil {
+			StopLocalWorkers()
+			return nil, err
+		}
+	}
+
+	return addrs, nil
+}
+
+// Wait until the worker daemon started as cmd is accepting connections on
+// the given address. Fails if the daemon exits first, e.g. because it could
+// not bind to the port.
+func waitForListener(addr string, cmd *exec.Cmd) os.Error {
+	deadline := time.Nanoseconds() + localStartTimeout
+
+	for {
+		if msg, err := cmd.Wait(os.WNOHANG); err != nil || msg.Pid != 0 {
+			return os.NewError(fmt.Sprintf("Local worker on %s exited before accepting connections", addr))
+		}
+
+		conn, err := net.Dial("tcp", "", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Nanoseconds() > deadline {
+			return os.NewError(fmt.Sprintf("Local worker on %s did not start: %s", addr, err.String()))
+		}
+
+		time.Sleep(localStartPoll)
+	}
+
+	return nil
+}
+
+// Log a fatal error and exit, stopping any local workers first, since
+// log.Fatalf exits without running deferred calls. A dashboard is stopped
+// too, so the log it was keeping and the error itself reach the terminal.
+func fatalf(format string, v ...interface{}) {
+	if activeDashboard != nil {
+		activeDashboard.Stop()
+	}
+	StopLocalWorkers()
+	log.Fatalf(format, v...)
+}
+
+// Kill any worker daemons started by StartLocalWorkers
+func StopLocalWorkers() {
+	for _, cmd := range localDaemons {
+		log.Printf("Stopping local worker with PID %d", cmd.Process.Pid)
+		if err := cmd.Process.Kill(); err != nil {
+			log.Printf("Could not stop local worker with PID %d: %s", cmd.Process.Pid, err.String())
+		}
+		cmd.Wait(0)
+		cmd.Close()
+	}
+
+	localDaemons = nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import "bytes"
+import "fmt"
+import "http"
+import "io"
+import "log"
+import "strings"
+
+// The fields of each worker's latest results exposed as metrics, along with
+// their metric names and help text
+var perfMetrics = []struct {
+	Name  string
+	Field func(*PerfData) float64
+	Help  string
+}{
+	{"connections_per_second", func(d *PerfData) float64 { return d.ConnectionsPerSecond }, "Connections per second achieved"},
+	{"requests_per_second", func(d *PerfData) float64 { return d.RequestsPerSecond }, "Requests per second achieved"},
+	{"replies_per_second", func(d *PerfData) float64 { return d.RepliesPerSecAvg }, "Mean replies per second"},
+	{"reply_time_response_ms", func(d *PerfData) float64 { return d.ReplyTimeResponse }, "Mean time to the first byte of a reply"},
+	{"connection_time_median_ms", func(d *PerfData) float64 { return d.ConnectionTimeMedian }, "Median connection time"},
+	{"connection_time_max_ms", func(d *PerfData) float64 { return d.ConnectionTimeMax }, "Maximum connection time"},
+	{"replies", func(d *PerfData) float64 { return d.TotalReplies }, "Replies received"},
+	{"errors", func(d *PerfData) float64 { return d.ErrTotal }, "Errors of any kind"},
+	{"offered_load", func(d *PerfData) float64 { return float64(d.OfferedLoad()) }, "Connection rate (or closed-loop clients) requested of the worker"},
+}
+
+// Escape a Prometheus label value
+func labelEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	return s
+}
+
+// Format a set of label names and values as {name="value",...}
+func formatLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for idx := 0; idx+1 < len(pairs); idx += 2 {
+		labels = append(labels, fmt.Sprintf("%s=\"%s\"", pairs[idx], labelEscape(pairs[idx+1])))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Write the status of the coordinator in the Prometheus text exposition
+// format: its current phase, step, rate and stress test state, the RPC
+// health of each worker, and the results of each worker from the last step.
+func WriteMetrics(w io.Writer, snapshot *StatusSnapshot) {
+	metric := func(name string, kind string, help string) {
+		fmt.Fprintf(w, "# HELP autohttperf_%s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE autohttperf_%s %s\n", name, kind)
+	}
+	sample := func(name string, labels string, value float64) {
+		fmt.Fprintf(w, "autohttperf_%s%s %g\n", name, labels, value)
+	}
+
+	phase := formatLabels("phase", snapshot.Phase, "mode", snapshot.Mode, "target", snapshot.Target)
+
+	metric("step", "gauge", "The step of the current phase")
+	sample("step", phase, float64(snapshot.Step))
+	metric("current_rate", "gauge", "The offered rate (or closed-loop clients) of the current step")
+	sample("current_rate", phase, float64(snapshot.Rate))
+	metric("error_state", "gauge", "Whether the stress test is in an error state")
+	sample("error_state", phase, boolValue(snapshot.ErrorState))
+	metric("cooldown_steps_remaining", "gauge", "The steps the stress test will take before stopping, once in an error state")
+	sample("cooldown_steps_remaining", phase, float64(snapshot.Cooldown))
+
+	metric("worker_up", "gauge", "Whether the last benchmark call to the worker succeeded over RPC")
+	for _, worker := range snapshot.Workers {
+		sample("worker_up", formatLabels("worker", worker.Label, "group", worker.Group), boolValue(worker.LastError == ""))
+	}
+	metric("worker_running", "gauge", "Whether the worker is running a benchmark")
+	for _, worker := range snapshot.Workers {
+		sample("worker_running", formatLabels("worker", worker.Label, "group", worker.Group), boolValue(worker.State == "running"))
+	}
+	metric("worker_rpc_calls_total", "counter", "Benchmark calls made to the worker")
+	for _, worker := range snapshot.Workers {
+		sample("worker_rpc_calls_total", formatLabels("worker", worker.Label, "group", worker.Group), float64(worker.Calls))
+	}
+	metric("worker_rpc_failures_total", "counter", "Benchmark calls to the worker that failed over RPC")
+	for _, worker := range snapshot.Workers {
+		sample("worker_rpc_failures_total", formatLabels("worker", worker.Label, "group", worker.Group), float64(worker.Failures))
+	}
+	metric("worker_call_seconds", "gauge", "The time taken by the current or last benchmark call to the worker")
+	for _, worker := range snapshot.Workers {
+		sample("worker_call_seconds", formatLabels("worker", worker.Label, "group", worker.Group), worker.Elapsed())
+	}
+
+	for _, perf := range perfMetrics {
+		metric("last_step_"+perf.Name, "gauge", perf.Help+", in the last step")
+		for _, perfdata := range snapshot.Latest {
+			labels := formatLabels("worker", perfdata.WorkerLabel, "group", perfdata.WorkerGroup,
+				"phase", perfdata.Phase, "target", perfdata.Target, "step", fmt.Sprint(perfdata.Step),
+				"trial", fmt.Sprint(perfdata.Trial))
+			sample("last_step_"+perf.Name, labels, perf.Field(perfdata))
+		}
+	}
+}
+
+// Serve the coordinator's metrics for Prometheus at /metrics on the given
+// address, in the background.
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		WriteMetrics(buf, coordinator.Snapshot())
+		w.Write(buf.Bytes())
+	})
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Could not serve metrics on %s: %s", addr, err.String())
+		}
+	}()
+
+	log.Printf("Serving metrics on http://%s/metrics", addr)
+}
@@ -0,0 +1,101 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestLabelEscape(t *testing.T) {
+	if got := labelEscape("a\\b\"c\nd"); got != "a\\\\b\\\"c\\nd" {
+		t.Errorf("Unexpected escaping: %s", got)
+	}
+	if got := formatLabels("worker", "w1", "group", "x\"y"); got != "{worker=\"w1\",group=\"x\\\"y\"}" {
+		t.Errorf("Unexpected labels: %s", got)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	status := NewStatus()
+	w1 := &Worker{id: "a:0", label: "w1", group: "east"}
+	w2 := &Worker{id: "b:1", label: "w2"}
+	status.SetWorkers([]*Worker{w1, w2})
+
+	phase := &Phase{Name: "ramp", Mode: "stressconn", Cooldown: 3}
+	status.SetPhase(phase)
+	status.SetStep(phase, 4, 250)
+	status.SetStressState(phase, true, 2)
+
+	status.WorkerStarted(w1)
+	status.WorkerFinished(w1, "", false)
+	status.WorkerStarted(w2)
+	status.WorkerFinished(w2, "connection refused", false)
+	status.Record([]*PerfData{&PerfData{Phase: "ramp", Step: 4, WorkerLabel: "w1", WorkerGroup: "east", ConnectionsPerSecond: 120.5, ErrTotal: 3}})
+
+	buf := new(bytes.Buffer)
+	WriteMetrics(buf, status.Snapshot())
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE autohttperf_current_rate gauge\n",
+		"autohttperf_current_rate{phase=\"ramp\",mode=\"stressconn\",target=\"\"} 250\n",
+		"autohttperf_step{phase=\"ramp\",mode=\"stressconn\",target=\"\"} 4\n",
+		"autohttperf_error_state{phase=\"ramp\",mode=\"stressconn\",target=\"\"} 1\n",
+		"autohttperf_cooldown_steps_remaining{phase=\"ramp\",mode=\"stressconn\",target=\"\"} 2\n",
+		"autohttperf_worker_up{worker=\"w1\",group=\"east\"} 1\n",
+		"autohttperf_worker_up{worker=\"w2\",group=\"\"} 0\n",
+		"autohttperf_worker_rpc_calls_total{worker=\"w2\",group=\"\"} 1\n",
+		"autohttperf_worker_rpc_failures_total{worker=\"w2\",group=\"\"} 1\n",
+		"# TYPE autohttperf_worker_rpc_failures_total counter\n",
+		"autohttperf_last_step_connections_per_second{worker=\"w1\",group=\"east\",phase=\"ramp\",target=\"\",step=\"4\",trial=\"0\"} 120.5\n",
+		"autohttperf_last_step_errors{worker=\"w1\",group=\"east\",phase=\"ramp\",target=\"\",step=\"4\",trial=\"0\"} 3\n",
+	}
+	for _, line := range expected {
+		if strings.Index(out, line) < 0 {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, out)
+		}
+	}
+}
+
+func TestWorkerUpRecovers(t *testing.T) {
+	status := NewStatus()
+	w := &Worker{id: "a:0", label: "w1"}
+	status.SetWorkers([]*Worker{w})
+
+	status.WorkerStarted(w)
+	status.WorkerFinished(w, "connection refused", false)
+	status.WorkerStarted(w)
+	status.WorkerFinished(w, "", false)
+
+	buf := new(bytes.Buffer)
+	WriteMetrics(buf, status.Snapshot())
+	out := buf.String()
+
+	if strings.Index(out, "autohttperf_worker_up{worker=\"w1\",group=\"\"} 1\n") < 0 {
+		t.Errorf("Expected the worker to be up after a successful call, got:\n%s", out)
+	}
+	if strings.Index(out, "autohttperf_worker_rpc_failures_total{worker=\"w1\",group=\"\"} 1\n") < 0 {
+		t.Errorf("Expected the earlier failure to still be counted, got:\n%s", out)
+	}
+}
+
+func TestStressStatePerTarget(t *testing.T) {
+	status := NewStatus()
+	phase := &Phase{Name: "ramp", Mode: "stressconn", Targets: "old=a,new=b"}
+	phase.targets = []Target{Target{"old", "a", 80}, Target{"new", "b", 80}}
+	status.SetPhase(phase)
+
+	targets := phase.TargetPhases()
+	status.SetStressState(targets[0], true, 2)
+	status.SetStep(targets[0], 3, 300)
+
+	// The next target hasn't failed, whatever the state of the last one
+	status.SetStressState(targets[1], false, 5)
+	status.SetStep(targets[1], 3, 300)
+
+	buf := new(bytes.Buffer)
+	WriteMetrics(buf, status.Snapshot())
+	out := buf.String()
+
+	if strings.Index(out, "autohttperf_error_state{phase=\"ramp\",mode=\"stressconn\",target=\"new\"} 0\n") < 0 {
+		t.Errorf("Expected the state of the target about to run, got:\n%s", out)
+	}
+}
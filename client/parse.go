@@ -49,6 +49,7 @@ func ParseResults(str string, id string, date int64, args *Args) (*PerfData, os.
 	data.ArgConnectionRate = args.ConnectionRate
 	data.ArgRequestsPerConnection = args.RequestsPerConnection
 	data.ArgDuration = args.Duration
+	data.ArgConcurrency = args.Concurrency
 
 	var conv float64
 	var err os.Error
@@ -1,5 +1,6 @@
 package main
 
+import "io/ioutil"
 import "reflect"
 import "strconv"
 import "testing"
@@ -133,3 +134,33 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+// The worker daemon writes a closed-loop benchmark in httperf's format, and
+// its tests check that it writes exactly this file
+func TestParseNativeReport(t *testing.T) {
+	report, err := ioutil.ReadFile("../server/testdata/native_report.txt")
+	if err != nil {
+		t.Fatalf("Could not read the worker's report: %s", err.String())
+	}
+
+	data, err := ParseResults(string(report), "native", 0, &Args{Concurrency: 4})
+	if err != nil {
+		t.Fatalf("Failed to parse the worker's report: %s", err.String())
+	}
+
+	if data.TotalConnections != 4 || data.TotalReplies != 7 || data.TestDuration != 10 {
+		t.Errorf("Unexpected totals: %f connections, %f replies in %f s",
+			data.TotalConnections, data.TotalReplies, data.TestDuration)
+	}
+	if data.ConnectionTimeMedian != 3 || data.ReplyTimeResponse != 2 || data.RepliesPerSecAvg != 0.7 {
+		t.Errorf("Unexpected times: median %f ms, response %f ms, %f replies/s",
+			data.ConnectionTimeMedian, data.ReplyTimeResponse, data.RepliesPerSecAvg)
+	}
+	if data.ReplyStatus_5xx != 1 || data.ErrTotal != 1 || data.ErrClientTimeout != 1 {
+		t.Errorf("Unexpected statuses and errors: %f 5xx, %f errors, %f timeouts",
+			data.ReplyStatus_5xx, data.ErrTotal, data.ErrClientTimeout)
+	}
+	if data.ArgConcurrency != 4 || data.OfferedLoad() != 4 {
+		t.Errorf("Expected the clients to be the offered load, got %d", data.OfferedLoad())
+	}
+}
@@ -0,0 +1,572 @@
+package main
+
+import "flag"
+import "fmt"
+import "io/ioutil"
+import "json"
+import "log"
+import "os"
+import "strings"
+import "time"
+
+// A change in the stress test step size. Once the rate reaches Rate, it is
+// increased by Step each round, until a later entry takes over.
+type RateStep struct {
+	Rate int
+	Step int
+}
+
+// The default stress test schedule, which starts stepping by 100 and carries
+// on that way.
+var defaultStressRates = []RateStep{
+	{0, 100},
+	{100, 100},
+}
+
+// A single phase of a benchmark run. Phases are built either from the mode
+// flags, or from a scenario file. Any field left out of a scenario file
+// takes the value of the corresponding command-line flag.
+type Phase struct {
+	Name string // Written into the Phase column of every output row
+	Mode string // One of "manual", "stressconn", "stressreqs", "soak", "spike" or "sweep"
+
+	// The target of the benchmark
+	Host     string
+	Port     int
+	URL      string
+	URLMix   string // A weighted URL list, used instead of URL
+	Requests int    // The number of requests sent per connection
+
+	// A list of targets, e.g. "old=10.0.0.1:80,new=10.0.0.2:80", used instead
+	// of Host and Port. Each step of a stress test is run against each target
+	// in turn.
+	Targets string
+
+	// Manual benchmark options
+	NumConnections int
+	Rate           int
+
+	// The number of clients of a manual benchmark, each kept busy with one
+	// connection at a time, instead of opening connections at a fixed rate
+	// (0 for open loop)
+	Concurrency int
+
+	// Stress test options, including the stop criteria
+	StartRate int
+	Steps     []RateStep
+	MaxRate   int // Stop once the rate passes this, 0 for no limit
+	NumErrors int
+	Cooldown  int
+
+	// Step the number of closed-loop clients rather than the connection
+	// rate, using the same start, schedule and maximum
+	StepConcurrency bool
+
+	// The number of trials of each step, and the number of median absolute
+	// deviations beyond which a trial is rejected (0 to keep them all)
+	Repeat   int
+	Outliers float64
+
+	// Step back down after errors to find the recovery rate, instead of
+	// continuing upwards through the cooldown. The recovery step defaults
+	// to the step size at the point of failure.
+	Recovery     bool
+	RecoveryStep int
+
+	Duration int // The duration of each step in seconds
+	Sleep    int // The time to sleep between steps, and after the phase
+
+	// Soak test options, the total duration and the length of each
+	// sampling window in seconds
+	SoakTime int
+	Window   int
+
+	// Spike test options. Rate is the baseline rate, and each spike runs at
+	// SpikeRate for SpikeLength seconds, followed by BaselineWindows windows
+	// of SpikeWindow seconds. RecoveryTolerance is a percentage.
+	SpikeRate         int
+	Spikes            int
+	SpikeLength       int
+	SpikeWindow       int
+	BaselineWindows   int
+	RecoveryTolerance float64
+
+	// Sweep options, comma-separated lists of the values of each dimension.
+	// A dimension without a list takes the single value of the phase. The
+	// order is "fixed" or "random", and a zero seed picks one at random.
+	SweepURLs     string
+	SweepRates    string
+	SweepRequests string
+	SweepOrder    string
+	SweepSeed     int64
+
+	// An unmeasured warmup before the phase, 0 for none. The warmup rate
+	// defaults to the first rate of the phase.
+	Warmup     int
+	WarmupRate int
+
+	mix       []URLWeight  // The parsed URL mix
+	sweepURLs []string     // The parsed list of swept URLs
+	sweep     []SweepPoint // Every combination of the sweep dimensions
+	targets   []Target     // The parsed list of targets
+	target    string       // The label of the target of this copy of the phase
+
+	// The fields given in the scenario file, by lower-case name, which keep
+	// their value even when it is zero
+	given map[string]bool
+}
+
+// A scenario file is a JSON object with an ordered list of phases, e.g.
+//
+//	{"Phases": [
+//		{"Name": "baseline", "Mode": "manual", "Rate": 100, "Duration": 30},
+//		{"Name": "ramp", "Mode": "stressconn", "URL": "/api", "StartRate": 100,
+//		 "Steps": [{"Rate": 0, "Step": 100}, {"Rate": 1000, "Step": 50}],
+//		 "MaxRate": 3000, "NumErrors": 100, "Duration": 20, "Sleep": 10}
+//	]}
+type Scenario struct {
+	Phases []*Phase
+}
+
+// A scenario file decoded without a struct, to tell which fields each phase
+// gives explicitly
+type rawScenario struct {
+	Phases []map[string]interface{}
+}
+
+var phaseModes = []string{"manual", "stressconn", "stressreqs", "soak", "spike", "sweep"}
+
+// Build a phase for the given mode entirely from the command-line flags
+func NewPhase(mode string) *Phase {
+	phase := &Phase{Name: mode, Mode: mode}
+	phase.fillDefaults()
+	return phase
+}
+
+// Whether a field should take the value of its flag: it is empty, and was
+// not given explicitly in a scenario file
+func (p *Phase) unset(field string, empty bool) bool {
+	return empty && !p.given[strings.ToLower(field)]
+}
+
+// Whether a field was given explicitly, either in a scenario file or as its
+// flag on the command line, rather than left to its default
+func (p *Phase) explicit(field string, flagName string) bool {
+	if p.given[strings.ToLower(field)] {
+		return true
+	}
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == flagName {
+			found = true
+		}
+	})
+	return found
+}
+
+// Fill any empty fields of the phase from the command-line flags, except
+// those a scenario file set to zero or false on purpose
+func (p *Phase) fillDefaults() {
+	if p.unset("Host", p.Host == "") {
+		p.Host = *server
+	}
+	if p.unset("Port", p.Port == 0) {
+		p.Port = *port
+	}
+	// A phase with its own URL does not take the -urlmix flag
+	if p.unset("URL", p.URL == "") {
+		p.URL = *url
+		if p.unset("URLMix", p.URLMix == "") {
+			p.URLMix = *urlMix
+		}
+	}
+	if p.unset("Targets", p.Targets == "") && p.Mode == "stressconn" {
+		p.Targets = *targets
+	}
+	if p.unset("Requests", p.Requests == 0) {
+		p.Requests = *requests
+	}
+	if p.unset("NumConnections", p.NumConnections == 0) {
+		p.NumConnections = *numConns
+	}
+	if p.unset("Rate", p.Rate == 0) {
+		p.Rate = *connRate
+	}
+	if p.unset("Concurrency", p.Concurrency == 0) {
+		p.Concurrency = *concurrency
+	}
+	if p.unset("StepConcurrency", !p.StepConcurrency) && p.Mode == "stressconn" {
+		p.StepConcurrency = *stepConcurrency
+	}
+	if p.unset("StartRate", p.StartRate == 0) {
+		p.StartRate = *startRate
+	}
+	if len(p.Steps) == 0 {
+		p.Steps = defaultStressRates
+	}
+	if p.unset("MaxRate", p.MaxRate == 0) {
+		p.MaxRate = *maxRate
+	}
+	if p.unset("NumErrors", p.NumErrors == 0) {
+		p.NumErrors = *numErrors
+	}
+	if p.unset("Cooldown", p.Cooldown == 0) {
+		p.Cooldown = *cooldown
+	}
+	if p.unset("Duration", p.Duration == 0) {
+		p.Duration = *duration
+	}
+	if p.unset("Repeat", p.Repeat == 0) {
+		p.Repeat = *repeat
+	}
+	if p.unset("Outliers", p.Outliers == 0) {
+		p.Outliers = *outliers
+	}
+	if p.unset("Recovery", !p.Recovery) {
+		p.Recovery = *recovery
+	}
+	if p.unset("RecoveryStep", p.RecoveryStep == 0) {
+		p.RecoveryStep = *recoveryStep
+	}
+	if p.unset("Sleep", p.Sleep == 0) {
+		p.Sleep = *sleep
+	}
+	if p.unset("SoakTime", p.SoakTime == 0) {
+		p.SoakTime = *soakTime
+	}
+	if p.unset("Window", p.Window == 0) {
+		p.Window = *soakWindow
+	}
+	if p.unset("SpikeRate", p.SpikeRate == 0) {
+		p.SpikeRate = *spikeRate
+	}
+	if p.unset("Spikes", p.Spikes == 0) {
+		p.Spikes = *spikes
+	}
+	if p.unset("SpikeLength", p.SpikeLength == 0) {
+		p.SpikeLength = *spikeLength
+	}
+	if p.unset("SpikeWindow", p.SpikeWindow == 0) {
+		p.SpikeWindow = *spikeWindow
+	}
+	if p.unset("BaselineWindows", p.BaselineWindows == 0) {
+		p.BaselineWindows = *baselineWindows
+	}
+	if p.unset("RecoveryTolerance", p.RecoveryTolerance == 0) {
+		p.RecoveryTolerance = *recoveryTolerance
+	}
+	if p.unset("SweepURLs", p.SweepURLs == "") {
+		p.SweepURLs = *sweepURLs
+	}
+	if p.unset("SweepRates", p.SweepRates == "") {
+		p.SweepRates = *sweepRates
+	}
+	if p.unset("SweepRequests", p.SweepRequests == "") {
+		p.SweepRequests = *sweepRequests
+	}
+	if p.unset("SweepOrder", p.SweepOrder == "") {
+		p.SweepOrder = *sweepOrder
+	}
+	if p.unset("SweepSeed", p.SweepSeed == 0) {
+		p.SweepSeed = *sweepSeed
+	}
+	if p.unset("WarmupRate", p.WarmupRate == 0) {
+		p.WarmupRate = *warmupRate
+	}
+}
+
+// Check the phase is runnable, and parse its URL mix
+func (p *Phase) validate() os.Error {
+	known := false
+	for _, mode := range phaseModes {
+		if p.Mode == mode {
+			known = true
+		}
+	}
+
+	if !known {
+		return os.NewError(fmt.Sprintf("Phase '%s' has unknown mode '%s'", p.Name, p.Mode))
+	}
+
+	if p.Repeat < 1 {
+		return os.NewError(fmt.Sprintf("Phase '%s' needs at least one trial per step", p.Name))
+	}
+
+	if p.Concurrency < 0 {
+		return os.NewError(fmt.Sprintf("Phase '%s' has a negative concurrency", p.Name))
+	}
+
+	if p.StepConcurrency && p.Mode != "stressconn" {
+		return os.NewError(fmt.Sprintf("Phase '%s' can only step concurrency in a stressconn phase", p.Name))
+	}
+
+	if p.Mode == "stressconn" {
+		if p.StartRate <= 0 {
+			return os.NewError(fmt.Sprintf("Phase '%s' needs a positive start rate", p.Name))
+		}
+		for _, entry := range p.Steps {
+			if entry.Step <= 0 {
+				return os.NewError(fmt.Sprintf("Phase '%s' has a step of %d from rate %d, steps must be positive", p.Name, entry.Step, entry.Rate))
+			}
+		}
+		if p.StepAt(p.StartRate) == 0 {
+			return os.NewError(fmt.Sprintf("Phase '%s' has no step for its start rate %d", p.Name, p.StartRate))
+		}
+	}
+
+	if p.Mode == "soak" && p.Window <= 0 {
+		return os.NewError(fmt.Sprintf("Phase '%s' needs a positive soak window", p.Name))
+	}
+
+	if p.Mode == "spike" && (p.SpikeLength <= 0 || p.SpikeWindow <= 0 || p.BaselineWindows <= 0) {
+		return os.NewError(fmt.Sprintf("Phase '%s' needs a positive spike length, window and number of baseline windows", p.Name))
+	}
+
+	if p.URLMix != "" {
+		mix, err := ParseURLMix(p.URLMix)
+		if err != nil {
+			return os.NewError(fmt.Sprintf("Phase '%s' has an invalid URL mix: %s", p.Name, err.String()))
+		}
+		p.mix = mix
+	}
+
+	if p.Targets != "" {
+		if p.Mode != "stressconn" {
+			return os.NewError(fmt.Sprintf("Phase '%s' can only have several targets in a stressconn phase", p.Name))
+		}
+
+		targets, err := ParseTargets(p.Targets, p.Port)
+		if err != nil {
+			return os.NewError(fmt.Sprintf("Phase '%s' has invalid targets: %s", p.Name, err.String()))
+		}
+		p.targets = targets
+	}
+
+	if p.Mode == "sweep" {
+		if err := p.parseSweep(); err != nil {
+			return os.NewError(fmt.Sprintf("Phase '%s' has an invalid sweep: %s", p.Name, err.String()))
+		}
+	}
+
+	return nil
+}
+
+// Parse the value lists of a sweep phase into every combination to be run
+func (p *Phase) parseSweep() os.Error {
+	if p.SweepOrder != "fixed" && p.SweepOrder != "random" {
+		return os.NewError(fmt.Sprintf("unknown order '%s'", p.SweepOrder))
+	}
+
+	p.sweepURLs = ParseURLList(p.SweepURLs)
+	urls := p.sweepURLs
+	if len(urls) == 0 {
+		url := p.URL
+		if len(p.mix) > 0 {
+			url = FormatURLMix(p.mix)
+		}
+		urls = []string{url}
+	}
+
+	rates, err := ParseIntList(p.SweepRates)
+	if err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		rates = []int{p.Rate}
+	}
+
+	requests, err := ParseIntList(p.SweepRequests)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		requests = []int{p.Requests}
+	}
+
+	p.sweep = SweepPoints(urls, rates, requests)
+	return nil
+}
+
+// Build the arguments for a single benchmark within this phase
+func (p *Phase) NewArgs(numconns int, rate int) *Args {
+	args := &Args{
+		Host:                  p.Host,
+		Port:                  p.Port,
+		URL:                   p.URL,
+		NumConnections:        numconns,
+		ConnectionRate:        rate,
+		RequestsPerConnection: p.Requests,
+		Duration:              p.Duration,
+	}
+
+	if len(p.mix) > 0 {
+		args.URL = FormatURLMix(p.mix)
+		args.WorkLog = BuildWorkLog(p.mix)
+	}
+
+	return args
+}
+
+// The step size of the stress test schedule at the given rate, or 0 if the
+// schedule does not start until a higher rate
+func (p *Phase) StepAt(rate int) int {
+	step := 0
+	from := -1
+	for _, entry := range p.Steps {
+		if entry.Rate <= rate && entry.Rate > from {
+			step = entry.Step
+			from = entry.Rate
+		}
+	}
+	return step
+}
+
+// Label a set of results with the name and target of this phase, and the
+// number of the step (or window) within it that produced them.
+func (p *Phase) Tag(data []*PerfData, step int) {
+	for _, perfdata := range data {
+		perfdata.Phase = p.Name
+		perfdata.Target = p.target
+		perfdata.Step = step
+	}
+}
+
+// Sleep for the configured time between steps or phases
+func (p *Phase) Pause() {
+	log.Printf("Sleeping for %d seconds", p.Sleep)
+	var sleeptime int64 = int64(p.Sleep) * 1000000000
+	time.Sleep(sleeptime)
+	log.Printf("Done sleeping")
+}
+
+// Build the phases selected by the mode flags. These are executed in the
+// order they are listed here, not the order they are specified on the
+// commandline.
+func PhasesFromFlags() ([]*Phase, os.Error) {
+	phases := make([]*Phase, 0, len(phaseModes))
+
+	if *modeManual {
+		phases = append(phases, NewPhase("manual"))
+	}
+	if *modeStressConn {
+		phases = append(phases, NewPhase("stressconn"))
+	}
+	if *modeStressReqs {
+		phases = append(phases, NewPhase("stressreqs"))
+	}
+	if *modeSoak {
+		phases = append(phases, NewPhase("soak"))
+	}
+	if *modeSpike {
+		phases = append(phases, NewPhase("spike"))
+	}
+	if *modeSweep {
+		phases = append(phases, NewPhase("sweep"))
+	}
+
+	for _, phase := range phases {
+		if err := phase.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return phases, nil
+}
+
+// Load the phases of a scenario file, filling in any fields it leaves out from
+// the command-line flags.
+func LoadScenario(filename string) ([]*Phase, os.Error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(contents, filename)
+}
+
+// Build the phases of a scenario from the contents of the named file
+func ParseScenario(contents []byte, filename string) ([]*Phase, os.Error) {
+	scenario := new(Scenario)
+	if err := json.Unmarshal(contents, scenario); err != nil {
+		return nil, os.NewError(fmt.Sprintf("Error parsing %s: %s", filename, err.String()))
+	}
+
+	if len(scenario.Phases) == 0 {
+		return nil, os.NewError(fmt.Sprintf("Scenario %s has no phases", filename))
+	}
+
+	// Field names are matched without regard to case, as in json.Unmarshal
+	raw := new(rawScenario)
+	if err := json.Unmarshal(contents, raw); err != nil {
+		return nil, os.NewError(fmt.Sprintf("Error parsing %s: %s", filename, err.String()))
+	}
+
+	for idx, phase := range scenario.Phases {
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("%s-%d", phase.Mode, idx+1)
+		}
+
+		phase.given = make(map[string]bool)
+		for name := range raw.Phases[idx] {
+			phase.given[strings.ToLower(name)] = true
+		}
+
+		phase.fillDefaults()
+		if err := phase.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return scenario.Phases, nil
+}
+
+// Run each of the phases in sequence, writing the results of each as they
+// become available. Returns the results of every phase.
+func RunPhases(workers []*Worker, phases []*Phase) []*PerfData {
+	all := make([]*PerfData, 0)
+
+	if !*skipheader {
+		WriteTSVHeader(os.Stdout)
+	}
+
+	for idx, phase := range phases {
+		log.Printf("Starting phase %d of %d: %s (%s)", idx+1, len(phases), phase.Name, phase.Mode)
+		coordinator.SetPhase(phase)
+
+		if phase.Warmup > 0 {
+			RunWarmup(workers, phase)
+		}
+
+		var data []*PerfData
+		switch phase.Mode {
+		case "manual":
+			data = RunManualBenchmark(workers, phase)
+		case "stressconn":
+			data = StressTestConnections(workers, phase)
+		case "stressreqs":
+			data = StressTestRequests(workers, phase)
+		case "soak":
+			data = SoakTest(workers, phase)
+		case "spike":
+			data = SpikeTest(workers, phase)
+		case "sweep":
+			data = SweepTest(workers, phase)
+		}
+
+		all = append(all, data...)
+
+		log.Printf("Finished phase %s", phase.Name)
+
+		if idx < len(phases)-1 {
+			phase.Pause()
+		}
+	}
+
+	return all
+}
+
+// Write a set of results to each of the configured outputs
+func WriteResults(data []*PerfData) {
+	WriteTSVParseDataSet(os.Stdout, data)
+	ExportResults(data)
+	coordinator.Record(data)
+}
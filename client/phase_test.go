@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestValidateSteps(t *testing.T) {
+	phase := NewPhase("stressconn")
+	phase.StartRate = 100
+	phase.Steps = []RateStep{{1000, 50}}
+	if err := phase.validate(); err == nil {
+		t.Errorf("Expected a schedule that starts above the start rate to be rejected")
+	}
+
+	phase.Steps = []RateStep{{0, 100}, {1000, 0}}
+	if err := phase.validate(); err == nil {
+		t.Errorf("Expected a zero step to be rejected")
+	}
+
+	phase.Steps = []RateStep{{100, 100}, {1000, 50}}
+	if err := phase.validate(); err != nil {
+		t.Errorf("Expected a schedule covering the start rate to be valid: %s", err.String())
+	}
+	if step := phase.StepAt(1500); step != 50 {
+		t.Errorf("Expected a step of 50 at rate 1500, got %d", step)
+	}
+}
+
+func TestScenarioExplicitZero(t *testing.T) {
+	contents := []byte(`{"Phases": [
+		{"Name": "quiet", "Mode": "stressconn", "sleep": 0, "Cooldown": 0, "MaxRate": 0, "Recovery": false},
+		{"Name": "defaults", "Mode": "stressconn"}
+	]}`)
+
+	phases, err := ParseScenario(contents, "test.json")
+	if err != nil {
+		t.Fatalf("Could not parse the scenario: %s", err.String())
+	}
+
+	quiet := phases[0]
+	if quiet.Sleep != 0 || quiet.Cooldown != 0 || quiet.MaxRate != 0 || quiet.Recovery {
+		t.Errorf("Expected explicit zeroes to be kept, got sleep %d, cooldown %d, max rate %d, recovery %v",
+			quiet.Sleep, quiet.Cooldown, quiet.MaxRate, quiet.Recovery)
+	}
+
+	defaults := phases[1]
+	if defaults.Sleep != *sleep || defaults.Cooldown != *cooldown {
+		t.Errorf("Expected missing fields to take the flags, got sleep %d, cooldown %d", defaults.Sleep, defaults.Cooldown)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "log"
+
+// Step the rate back down after a stress test has found errors at failRate,
+// to find the rate at which the server recovers. The difference between the
+// two rates is the hysteresis gap: how far the load has to drop below the
+// point of failure before the server copes again. The steps are numbered on
+// from stepNum, and the results of each are returned.
+func FindRecoveryRate(workers []*Worker, phase *Phase, failRate int, step int, stepNum int) []*PerfData {
+	down := phase.RecoveryStep
+	if down <= 0 {
+		down = step
+	}
+
+	// Without a usable step, search down in tenths of the failure rate
+	if down <= 0 {
+		down = failRate / 10
+		if down < 1 {
+			down = 1
+		}
+	}
+
+	all := make([]*PerfData, 0)
+
+	for rate := failRate - down; rate > 0; rate -= down {
+		log.Printf("Recovery search, current rate: %d, step: -%d", rate, down)
+		phase.Pause()
+
+		stepNum++
+		data, stats := RunStressStep(workers, phase, rate, stepNum)
+		all = append(all, data...)
+
+		if !stats.HasErrors(phase.NumErrors) {
+			gap := failRate - rate
+			log.Printf("Server failed at rate %d and recovered at rate %d", failRate, rate)
+			log.Printf("Hysteresis gap: %d (%.1f%% of the failure rate)", gap,
+				float64(gap)/float64(failRate)*100)
+			return all
+		}
+	}
+
+	log.Printf("Server failed at rate %d and did not recover at any lower rate", failRate)
+	return all
+}
@@ -0,0 +1,342 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "os"
+import "sort"
+import "time"
+
+// A single step of a series in the report, combined over its workers
+type reportStep struct {
+	Step    int
+	Load    int
+	Agg     *PerfData
+	Workers []*PerfData
+}
+
+type reportSteps []*reportStep
+
+func (s reportSteps) Len() int           { return len(s) }
+func (s reportSteps) Less(i, j int) bool { return s[i].Step < s[j].Step }
+func (s reportSteps) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// The steps of one phase and target. When every step has a different load
+// the charts are plotted against it, otherwise (as for a soak test) against
+// the step number.
+type reportSeries struct {
+	resultSeries
+	Steps  reportSteps
+	ByLoad bool
+}
+
+// Group a set of results into series and steps, leaving out the warmup.
+// Repeated trials of a step are combined along with its workers.
+func buildReportSeries(data []*PerfData) []*reportSeries {
+	measured := make([]*PerfData, 0, len(data))
+	for _, perfdata := range data {
+		if !perfdata.Warmup {
+			measured = append(measured, perfdata)
+		}
+	}
+
+	order, split := splitSeries(measured)
+	all := make([]*reportSeries, 0, len(order))
+
+	for _, s := range order {
+		series := &reportSeries{resultSeries: s, ByLoad: true}
+		steps := make(map[int]*reportStep)
+
+		for _, perfdata := range split[s.Phase+"\x00"+s.Target] {
+			step, ok := steps[perfdata.Step]
+			if !ok {
+				step = &reportStep{Step: perfdata.Step}
+				steps[perfdata.Step] = step
+				series.Steps = append(series.Steps, step)
+			}
+			step.Workers = append(step.Workers, perfdata)
+		}
+
+		sort.Sort(series.Steps)
+
+		loads := make(map[int]bool)
+		for _, step := range series.Steps {
+			step.Agg = AggregatePerfData(step.Workers)
+
+			// Repeated trials are summed along with the workers, so divide
+			// through to give the mean of a trial
+			trials := make(map[int]bool)
+			for _, perfdata := range step.Workers {
+				trials[perfdata.Trial] = true
+			}
+			if len(trials) > 1 {
+				meanOfTrials(step.Agg, len(trials))
+			}
+			step.Load = step.Agg.StepLoad()
+
+			if loads[step.Load] {
+				series.ByLoad = false
+			}
+			loads[step.Load] = true
+		}
+
+		all = append(all, series)
+	}
+
+	return all
+}
+
+// Divide the summed fields of an aggregate of several trials by the number
+// of trials, so that it holds the mean of a trial.
+func meanOfTrials(agg *PerfData, trials int) {
+	n := float64(trials)
+	agg.ArgNumConnections /= trials
+	agg.ArgConnectionRate /= trials
+	agg.ArgConcurrency /= trials
+	agg.TotalConnections /= n
+	agg.TotalRequests /= n
+	agg.TotalReplies /= n
+	agg.ConnectionsPerSecond /= n
+	agg.ConcurrentConnections /= n
+	agg.RequestsPerSecond /= n
+	agg.RepliesPerSecAvg /= n
+	agg.RepliesPerSecMax /= n
+	agg.RepliesPerSecNumSamples /= n
+	agg.ReplyStatus_1xx /= n
+	agg.ReplyStatus_2xx /= n
+	agg.ReplyStatus_3xx /= n
+	agg.ReplyStatus_4xx /= n
+	agg.ReplyStatus_5xx /= n
+	agg.CpuTimeUser /= n
+	agg.CpuTimeSystem /= n
+	agg.NetIOValue /= n
+	agg.ErrTotal /= n
+	agg.ErrClientTimeout /= n
+	agg.ErrSocketTimeout /= n
+	agg.ErrConnectionRefused /= n
+	agg.ErrConnectionReset /= n
+	agg.ErrFdUnavail /= n
+	agg.ErrAddRunAvail /= n
+	agg.ErrFtabFull /= n
+	agg.ErrOther /= n
+
+	// The per-connection and per-request times follow from the rates
+	agg.MsPerConnection *= n
+	agg.MsPerRequest *= n
+}
+
+// The X value of a step, and the label of the X axis
+func (s *reportSeries) x(step *reportStep) float64 {
+	if s.ByLoad {
+		return float64(step.Load)
+	}
+	return float64(step.Step)
+}
+
+func (s *reportSeries) xLabel() string {
+	if s.ByLoad {
+		return "Offered rate (conn/s, or clients)"
+	}
+	return "Step"
+}
+
+// A line chart of one or more fields of each step against the X axis
+func (s *reportSeries) lineChart(title string, ylabel string, names []string, fields []func(*PerfData) float64) *Chart {
+	chart := &Chart{Title: title, XLabel: s.xLabel(), YLabel: ylabel}
+
+	// Plot the points in order along the X axis
+	steps := make(reportSteps, len(s.Steps))
+	copy(steps, s.Steps)
+	if s.ByLoad {
+		SortByLoad(steps)
+	}
+
+	for idx, name := range names {
+		x := make([]float64, 0, len(steps))
+		y := make([]float64, 0, len(steps))
+		for _, step := range steps {
+			x = append(x, s.x(step))
+			y = append(y, fields[idx](step.Agg))
+		}
+		chart.Add(name, x, y)
+	}
+
+	return chart
+}
+
+// A stacked bar chart of one or more fields of each step
+func (s *reportSeries) barChart(title string, ylabel string, names []string, fields []func(*PerfData) float64) *Chart {
+	chart := s.lineChart(title, ylabel, names, fields)
+	chart.Stacked = true
+	return chart
+}
+
+type byLoad struct{ reportSteps }
+
+func (s byLoad) Less(i, j int) bool { return s.reportSteps[i].Load < s.reportSteps[j].Load }
+
+// Sort steps by their offered load
+func SortByLoad(steps reportSteps) {
+	sort.Sort(byLoad{steps})
+}
+
+// The charts drawn for every series
+func (s *reportSeries) charts() []*Chart {
+	offered := func(d *PerfData) float64 { return float64(d.OfferedLoad()) }
+
+	return []*Chart{
+		s.lineChart("Offered and achieved rate", "conn/s",
+			[]string{"Offered", "Achieved"},
+			[]func(*PerfData) float64{
+				offered,
+				func(d *PerfData) float64 { return d.ConnectionsPerSecond },
+			}),
+		s.lineChart("Connection time", "ms",
+			[]string{"Min", "Avg", "Median", "Max"},
+			[]func(*PerfData) float64{
+				func(d *PerfData) float64 { return d.ConnectionTimeMin },
+				func(d *PerfData) float64 { return d.ConnectionTimeAvg },
+				func(d *PerfData) float64 { return d.ConnectionTimeMedian },
+				func(d *PerfData) float64 { return d.ConnectionTimeMax },
+			}),
+		s.barChart("Reply status", "replies",
+			[]string{"1xx", "2xx", "3xx", "4xx", "5xx"},
+			[]func(*PerfData) float64{
+				func(d *PerfData) float64 { return d.ReplyStatus_1xx },
+				func(d *PerfData) float64 { return d.ReplyStatus_2xx },
+				func(d *PerfData) float64 { return d.ReplyStatus_3xx },
+				func(d *PerfData) float64 { return d.ReplyStatus_4xx },
+				func(d *PerfData) float64 { return d.ReplyStatus_5xx },
+			}),
+		s.barChart("Errors by type", "errors",
+			[]string{"client-timo", "socket-timo", "connrefused", "connreset", "fd-unavail", "addrunavail", "ftab-full", "other"},
+			[]func(*PerfData) float64{
+				func(d *PerfData) float64 { return d.ErrClientTimeout },
+				func(d *PerfData) float64 { return d.ErrSocketTimeout },
+				func(d *PerfData) float64 { return d.ErrConnectionRefused },
+				func(d *PerfData) float64 { return d.ErrConnectionReset },
+				func(d *PerfData) float64 { return d.ErrFdUnavail },
+				func(d *PerfData) float64 { return d.ErrAddRunAvail },
+				func(d *PerfData) float64 { return d.ErrFtabFull },
+				func(d *PerfData) float64 { return d.ErrOther },
+			}),
+	}
+}
+
+const reportStyle = `body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; font-size: 13px; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: right; }
+th { background: #eee; }
+td.text { text-align: left; }
+svg { margin: 0 1em 1em 0; }`
+
+// Write a table with a header row, and a row for each set of cells. Cells
+// are escaped, and the first textColumns are aligned to the left.
+func writeHTMLTable(w io.Writer, header []string, rows [][]string, textColumns int) {
+	fmt.Fprintf(w, "<table>\n<tr>")
+	for _, name := range header {
+		fmt.Fprintf(w, "<th>%s</th>", xmlEscape(name))
+	}
+	fmt.Fprintf(w, "</tr>\n")
+
+	for _, row := range rows {
+		fmt.Fprintf(w, "<tr>")
+		for idx, cell := range row {
+			if idx < textColumns {
+				fmt.Fprintf(w, "<td class=\"text\">%s</td>", xmlEscape(cell))
+			} else {
+				fmt.Fprintf(w, "<td>%s</td>", xmlEscape(cell))
+			}
+		}
+		fmt.Fprintf(w, "</tr>\n")
+	}
+	fmt.Fprintf(w, "</table>\n")
+}
+
+// Write a self-contained HTML report of a run: the parameters of each
+// phase, then for each phase (and target) charts of the rate, connection
+// time, reply status and errors, a table of the steps and a table of the
+// results of each worker.
+func WriteHTMLReport(w io.Writer, data []*PerfData, phases []*Phase) {
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(w, "<title>autohttperf report</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", reportStyle)
+	fmt.Fprintf(w, "<h1>autohttperf report</h1>\n")
+
+	if len(data) > 0 {
+		started := time.SecondsToLocalTime(data[0].BenchmarkDate)
+		fmt.Fprintf(w, "<p>Started %s, %d results from %d phases.</p>\n",
+			xmlEscape(started.Format(time.RFC1123)), len(data), len(phases))
+	}
+
+	fmt.Fprintf(w, "<h2>Run parameters</h2>\n")
+	rows := make([][]string, 0, len(phases))
+	for _, phase := range phases {
+		url := phase.URL
+		if phase.URLMix != "" {
+			url = phase.URLMix
+		}
+		server := fmt.Sprintf("%s:%d", phase.Host, phase.Port)
+		if phase.Targets != "" {
+			server = phase.Targets
+		}
+		rows = append(rows, []string{
+			phase.Name, phase.Mode, server, url,
+			fmt.Sprint(phase.Requests), fmt.Sprint(phase.Rate), fmt.Sprint(phase.Concurrency),
+			fmt.Sprint(phase.StartRate), fmt.Sprint(phase.MaxRate), fmt.Sprint(phase.Duration),
+			fmt.Sprint(phase.Repeat), fmt.Sprint(phase.NumErrors), fmt.Sprint(phase.Warmup),
+		})
+	}
+	writeHTMLTable(w, []string{"Phase", "Mode", "Server", "URL", "Requests/conn", "Rate", "Clients",
+		"Start rate", "Max rate", "Duration", "Trials", "Max errors", "Warmup"}, rows, 4)
+
+	for _, series := range buildReportSeries(data) {
+		title := "Phase " + series.Phase
+		if series.Target != "" {
+			title += ", target " + series.Target
+		}
+		fmt.Fprintf(w, "<h2>%s</h2>\n<div>\n", xmlEscape(title))
+
+		for _, chart := range series.charts() {
+			io.WriteString(w, chart.SVG())
+		}
+		fmt.Fprintf(w, "</div>\n")
+
+		fmt.Fprintf(w, "<h3>Steps</h3>\n")
+		rows = make([][]string, 0, len(series.Steps))
+		for _, step := range series.Steps {
+			agg := step.Agg
+			rows = append(rows, []string{
+				fmt.Sprint(step.Step), fmt.Sprint(step.Load),
+				fmt.Sprintf("%.1f", agg.ConnectionsPerSecond), fmt.Sprintf("%.1f", agg.RequestsPerSecond),
+				fmt.Sprintf("%.1f", agg.ReplyTimeResponse), fmt.Sprintf("%.1f", agg.ConnectionTimeMedian),
+				fmt.Sprintf("%.0f", agg.ReplyStatus_2xx), fmt.Sprintf("%.0f", agg.ErrTotal),
+			})
+		}
+		writeHTMLTable(w, []string{"Step", "Offered", "Conn/s", "Req/s", "Reply time (ms)",
+			"Median conn time (ms)", "2xx", "Errors"}, rows, 0)
+
+		fmt.Fprintf(w, "<h3>Workers</h3>\n")
+		rows = make([][]string, 0)
+		for _, step := range series.Steps {
+			for _, perfdata := range step.Workers {
+				rows = append(rows, []string{
+					perfdata.WorkerLabel, perfdata.WorkerGroup,
+					fmt.Sprint(step.Step), fmt.Sprint(perfdata.Trial), fmt.Sprint(perfdata.OfferedLoad()),
+					fmt.Sprintf("%.1f", perfdata.ConnectionsPerSecond), fmt.Sprintf("%.1f", perfdata.ReplyTimeResponse),
+					fmt.Sprintf("%.0f", perfdata.ErrTotal), fmt.Sprintf("%.1f", perfdata.WorkerElapsed),
+				})
+			}
+		}
+		writeHTMLTable(w, []string{"Worker", "Group", "Step", "Trial", "Offered", "Conn/s",
+			"Reply time (ms)", "Errors", "Elapsed (s)"}, rows, 2)
+	}
+
+	fmt.Fprintf(w, "</body>\n</html>\n")
+}
+
+func writeHTMLFile(filename string, data []*PerfData, phases []*Phase) os.Error {
+	buf := new(bytes.Buffer)
+	WriteHTMLReport(buf, data, phases)
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
@@ -0,0 +1,69 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestNiceCeil(t *testing.T) {
+	cases := map[float64]float64{0: 1, 0.3: 0.5, 1: 1, 7: 10, 120: 200, 4500: 5000}
+	for value, expected := range cases {
+		if ceil := niceCeil(value); ceil != expected {
+			t.Errorf("Expected %g to round up to %g, got %g", value, expected, ceil)
+		}
+	}
+}
+
+func TestBuildReportSeries(t *testing.T) {
+	data := []*PerfData{
+		&PerfData{Phase: "ramp", Step: 0, Warmup: true, ArgConnectionRate: 50},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 1, ArgConnectionRate: 50, ConnectionsPerSecond: 50},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 1, ArgConnectionRate: 50, ConnectionsPerSecond: 50},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 2, ArgConnectionRate: 50, ConnectionsPerSecond: 40},
+		&PerfData{Phase: "ramp", Step: 1, Trial: 2, ArgConnectionRate: 50, ConnectionsPerSecond: 40},
+		&PerfData{Phase: "ramp", Step: 2, ArgConnectionRate: 200, ConnectionsPerSecond: 180},
+		&PerfData{Phase: "soak", Step: 1, ArgConnectionRate: 100},
+		&PerfData{Phase: "soak", Step: 2, ArgConnectionRate: 100},
+	}
+
+	series := buildReportSeries(data)
+	if len(series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(series))
+	}
+
+	ramp, soak := series[0], series[1]
+	if len(ramp.Steps) != 2 || !ramp.ByLoad {
+		t.Fatalf("Expected 2 steps plotted by load, got %d (by load %v)", len(ramp.Steps), ramp.ByLoad)
+	}
+
+	// The workers are summed, and the trials averaged
+	first := ramp.Steps[0]
+	if first.Load != 100 || first.Agg.ConnectionsPerSecond != 90 {
+		t.Errorf("Expected load 100 at 90 conn/s, got %d at %f", first.Load, first.Agg.ConnectionsPerSecond)
+	}
+
+	if soak.ByLoad {
+		t.Errorf("Expected the soak test to be plotted by step")
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	data := []*PerfData{
+		&PerfData{Phase: "ramp", Step: 1, ArgConnectionRate: 100, ConnectionsPerSecond: 99, WorkerLabel: "<w1>"},
+		&PerfData{Phase: "ramp", Step: 2, ArgConnectionRate: 200, ConnectionsPerSecond: 150, ErrOther: 5},
+	}
+	phases := []*Phase{&Phase{Name: "ramp", Mode: "stressconn"}}
+
+	buf := new(bytes.Buffer)
+	WriteHTMLReport(buf, data, phases)
+	report := buf.String()
+
+	if count := strings.Count(report, "<svg "); count != 4 {
+		t.Errorf("Expected 4 charts, got %d", count)
+	}
+	if strings.Index(report, "&lt;w1&gt;") < 0 || strings.Index(report, "<w1>") >= 0 {
+		t.Errorf("Expected the worker label to be escaped")
+	}
+	if !strings.HasSuffix(report, "</html>\n") {
+		t.Errorf("Expected the report to be complete")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import "log"
+
+// Hold a fixed rate for a long time to catch memory leaks and slow
+// degradation. The run is split into back-to-back sampling windows, each of
+// which is written as it completes, and the drift in latency and error rate
+// between the first and last windows is reported at the end.
+func SoakTest(workers []*Worker, phase *Phase) []*PerfData {
+	windows := phase.SoakTime / phase.Window
+	if windows < 1 {
+		windows = 1
+	}
+
+	log.Printf("Soaking at rate %d for %d windows of %d seconds", phase.Rate, windows, phase.Window)
+
+	schedule := make([]int, windows)
+	for idx := range schedule {
+		schedule[idx] = phase.Rate
+	}
+	coordinator.SetSchedule(schedule)
+
+	all := make([]*PerfData, 0)
+	aggregates := make([]*PerfData, 0, windows)
+
+	for window := 1; window <= windows; window++ {
+		data, agg := RunWindow(workers, phase, phase.Rate, phase.Window, window, false)
+		all = append(all, data...)
+		aggregates = append(aggregates, agg)
+
+		log.Printf("Soak window %d of %d: %.1f conn/s, median connection time %.1f ms, error rate %.4f",
+			window, windows, agg.ConnectionsPerSecond, agg.ConnectionTimeMedian, errorRate(agg))
+	}
+
+	if len(aggregates) > 1 {
+		first := aggregates[0]
+		last := aggregates[len(aggregates)-1]
+
+		log.Printf("Soak drift in median connection time: %.1f ms to %.1f ms (%+.1f%%)",
+			first.ConnectionTimeMedian, last.ConnectionTimeMedian,
+			percentChange(first.ConnectionTimeMedian, last.ConnectionTimeMedian))
+		log.Printf("Soak drift in reply time: %.1f ms to %.1f ms (%+.1f%%)",
+			first.ReplyTimeResponse, last.ReplyTimeResponse,
+			percentChange(first.ReplyTimeResponse, last.ReplyTimeResponse))
+		log.Printf("Soak drift in error rate: %.4f to %.4f (%+.4f)",
+			errorRate(first), errorRate(last), errorRate(last)-errorRate(first))
+	}
+
+	return all
+}
+
+// Run a single fixed-rate window of the given length in seconds, writing the
+// results as step 'step' of the phase, marked as a spike if requested.
+// Returns the results of each worker along with their aggregate.
+func RunWindow(workers []*Worker, phase *Phase, rate int, length int, step int, spike bool) ([]*PerfData, *PerfData) {
+	args := phase.NewArgs(rate*length, rate)
+	args.Duration = length
+	coordinator.SetStep(phase, step, rate)
+
+	data, ok := RunDistributedBenchmark(workers, args)
+	if !ok {
+		log.Printf("Window %d of phase %s did not fully succeed", step, phase.Name)
+	}
+
+	for _, perfdata := range data {
+		perfdata.Spike = spike
+	}
+
+	phase.Tag(data, step)
+	WriteResults(data)
+
+	return data, AggregatePerfData(data)
+}
+
+// The fraction of connections that resulted in an error
+func errorRate(data *PerfData) float64 {
+	if data.TotalConnections == 0 {
+		return 0
+	}
+	return data.ErrTotal / data.TotalConnections
+}
+
+// The change from one value to another as a percentage of the first, or zero
+// if the first value is zero.
+func percentChange(from float64, to float64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return (to - from) / from * 100
+}
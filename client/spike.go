@@ -0,0 +1,88 @@
+package main
+
+import "log"
+
+// Alternate a baseline rate with short high-rate bursts, to see how the
+// server behaves during and after each spike. Each spike is followed by a
+// number of baseline windows, and the recovery time of a spike is the number
+// of those windows it takes for the median connection time and error rate to
+// return to within the tolerance of the baseline measured before the first
+// spike.
+func SpikeTest(workers []*Worker, phase *Phase) []*PerfData {
+	all := make([]*PerfData, 0)
+	step := 0
+
+	// Baseline windows, then each spike followed by its recovery windows
+	schedule := make([]int, 0)
+	for idx := 0; idx < phase.BaselineWindows; idx++ {
+		schedule = append(schedule, phase.Rate)
+	}
+	for spike := 1; spike <= phase.Spikes; spike++ {
+		schedule = append(schedule, phase.SpikeRate)
+		for idx := 0; idx < phase.BaselineWindows; idx++ {
+			schedule = append(schedule, phase.Rate)
+		}
+	}
+	coordinator.SetSchedule(schedule)
+
+	log.Printf("Measuring baseline at rate %d for %d windows", phase.Rate, phase.BaselineWindows)
+
+	baselineData := make([]*PerfData, 0)
+	for idx := 0; idx < phase.BaselineWindows; idx++ {
+		step++
+		data, _ := RunWindow(workers, phase, phase.Rate, phase.SpikeWindow, step, false)
+		all = append(all, data...)
+		baselineData = append(baselineData, data...)
+	}
+
+	// Combining every baseline window gives a steadier reference point
+	baseline := AggregatePerfData(baselineData)
+	log.Printf("Baseline: median connection time %.1f ms, error rate %.4f",
+		baseline.ConnectionTimeMedian, errorRate(baseline))
+
+	for spike := 1; spike <= phase.Spikes; spike++ {
+		log.Printf("Spike %d of %d at rate %d for %d seconds", spike, phase.Spikes, phase.SpikeRate, phase.SpikeLength)
+
+		step++
+		data, burst := RunWindow(workers, phase, phase.SpikeRate, phase.SpikeLength, step, true)
+		all = append(all, data...)
+
+		after := make([]*PerfData, 0, phase.BaselineWindows)
+		for idx := 0; idx < phase.BaselineWindows; idx++ {
+			step++
+			data, agg := RunWindow(workers, phase, phase.Rate, phase.SpikeWindow, step, false)
+			all = append(all, data...)
+			after = append(after, agg)
+		}
+
+		log.Printf("Spike %d: %.1f conn/s, median connection time %.1f ms, %.0f errors",
+			spike, burst.ConnectionsPerSecond, burst.ConnectionTimeMedian, burst.ErrTotal)
+
+		recovery := WindowsToRecover(baseline, after, phase.RecoveryTolerance)
+		if recovery < 0 {
+			log.Printf("Spike %d: did not recover within %d windows", spike, len(after))
+		} else {
+			log.Printf("Spike %d: recovered within %d windows", spike, recovery)
+		}
+	}
+
+	return all
+}
+
+// The number of windows after a spike up to and including the first in which
+// the median connection time and error rate are back within the tolerance (a
+// percentage) of the baseline. Returns 1 if the first window after the spike
+// had already recovered, or -1 if none of them did.
+func WindowsToRecover(baseline *PerfData, after []*PerfData, tolerance float64) int {
+	scale := 1 + tolerance/100
+	maxMedian := baseline.ConnectionTimeMedian * scale
+	maxErrors := errorRate(baseline) * scale
+
+	for idx, agg := range after {
+		if agg.ConnectionTimeMedian <= maxMedian && errorRate(agg) <= maxErrors {
+			return idx + 1
+		}
+	}
+
+	return -1
+}
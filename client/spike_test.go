@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestWindowsToRecover(t *testing.T) {
+	baseline := &PerfData{ConnectionTimeMedian: 10, TotalConnections: 1000, ErrTotal: 10}
+
+	after := []*PerfData{
+		&PerfData{ConnectionTimeMedian: 50, TotalConnections: 1000, ErrTotal: 100},
+		&PerfData{ConnectionTimeMedian: 11, TotalConnections: 1000, ErrTotal: 30},
+		&PerfData{ConnectionTimeMedian: 11, TotalConnections: 1000, ErrTotal: 11},
+		&PerfData{ConnectionTimeMedian: 10, TotalConnections: 1000, ErrTotal: 10},
+	}
+
+	if windows := WindowsToRecover(baseline, after, 20); windows != 3 {
+		t.Errorf("Expected recovery within 3 windows, got %d", windows)
+	}
+
+	if windows := WindowsToRecover(baseline, after, 0); windows != 4 {
+		t.Errorf("Expected recovery within 4 windows with no tolerance, got %d", windows)
+	}
+
+	if windows := WindowsToRecover(baseline, after[3:], 0); windows != 1 {
+		t.Errorf("Expected recovery within the first window, got %d", windows)
+	}
+
+	if windows := WindowsToRecover(baseline, after[:2], 20); windows != -1 {
+		t.Errorf("Expected no recovery, got %d", windows)
+	}
+}
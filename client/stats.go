@@ -0,0 +1,164 @@
+package main
+
+import "log"
+import "math"
+import "sort"
+
+// Summary statistics of a set of samples
+type Stats struct {
+	N      int // The number of samples used, after any outliers
+	Mean   float64
+	Stddev float64 // The sample standard deviation
+	CI95   float64 // The half-width of the 95% confidence interval of the mean
+}
+
+// Two-sided 95% critical values of Student's t distribution, indexed by the
+// degrees of freedom. Larger samples use the normal approximation.
+var tCritical95 = []float64{
+	0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// Compute the mean, standard deviation and 95% confidence interval of a set
+// of samples. With fewer than two samples the spread is reported as zero.
+func ComputeStats(values []float64) Stats {
+	stats := Stats{N: len(values)}
+	if stats.N == 0 {
+		return stats
+	}
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	stats.Mean = sum / float64(stats.N)
+
+	if stats.N < 2 {
+		return stats
+	}
+
+	squares := 0.0
+	for _, value := range values {
+		squares += (value - stats.Mean) * (value - stats.Mean)
+	}
+	stats.Stddev = math.Sqrt(squares / float64(stats.N-1))
+
+	t := 1.96
+	if df := stats.N - 1; df < len(tCritical95) {
+		t = tCritical95[df]
+	}
+	stats.CI95 = t * stats.Stddev / math.Sqrt(float64(stats.N))
+
+	return stats
+}
+
+type float64Slice []float64
+
+func (p float64Slice) Len() int           { return len(p) }
+func (p float64Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p float64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// The median of a set of values, which are left unchanged
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Sort(float64Slice(sorted))
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Drop any values more than k scaled median absolute deviations from the
+// median. The MAD is robust to the outliers themselves, unlike the standard
+// deviation, which matters with only a handful of trials. If the MAD is zero
+// every value is kept.
+func RejectOutliers(values []float64, k float64) []float64 {
+	m := median(values)
+
+	deviations := make([]float64, len(values))
+	for idx, value := range values {
+		deviations[idx] = math.Abs(value - m)
+	}
+
+	// Scale the MAD to be comparable with a standard deviation
+	mad := 1.4826 * median(deviations)
+	if mad == 0 {
+		return values
+	}
+
+	kept := make([]float64, 0, len(values))
+	for idx, value := range values {
+		if deviations[idx] <= k*mad {
+			kept = append(kept, value)
+		}
+	}
+
+	return kept
+}
+
+// The statistics of the key metrics over the repeated trials of one step.
+// Each trial is first aggregated over the workers.
+type StepStats struct {
+	ConnectionsPerSecond Stats
+	ReplyTimeResponse    Stats
+	ErrTotal             Stats
+}
+
+// Compute the statistics of a set of trials, rejecting outliers in the
+// throughput and reply time if k is positive. Errors are never rejected: a
+// trial with an error spike is exactly what the error threshold must see.
+func ComputeStepStats(trials [][]*PerfData, k float64) *StepStats {
+	rates := make([]float64, 0, len(trials))
+	times := make([]float64, 0, len(trials))
+	errors := make([]float64, 0, len(trials))
+
+	for _, trial := range trials {
+		agg := AggregatePerfData(trial)
+		rates = append(rates, agg.ConnectionsPerSecond)
+		times = append(times, agg.ReplyTimeResponse)
+		errors = append(errors, agg.ErrTotal)
+	}
+
+	if k > 0 {
+		rates = rejectAndLog("ConnectionsPerSecond", rates, k)
+		times = rejectAndLog("ReplyTimeResponse", times, k)
+	}
+
+	return &StepStats{ComputeStats(rates), ComputeStats(times), ComputeStats(errors)}
+}
+
+func rejectAndLog(name string, values []float64, k float64) []float64 {
+	kept := RejectOutliers(values, k)
+	if len(kept) < len(values) {
+		log.Printf("Rejected %d outlying trials of %s", len(values)-len(kept), name)
+	}
+	return kept
+}
+
+// Copy the statistics into the corresponding columns of a set of results
+func (s *StepStats) Apply(data []*PerfData) {
+	for _, perfdata := range data {
+		perfdata.ConnectionsPerSecondMean = s.ConnectionsPerSecond.Mean
+		perfdata.ConnectionsPerSecondStddev = s.ConnectionsPerSecond.Stddev
+		perfdata.ConnectionsPerSecondCI95 = s.ConnectionsPerSecond.CI95
+		perfdata.ReplyTimeResponseMean = s.ReplyTimeResponse.Mean
+		perfdata.ReplyTimeResponseStddev = s.ReplyTimeResponse.Stddev
+		perfdata.ReplyTimeResponseCI95 = s.ReplyTimeResponse.CI95
+		perfdata.ErrTotalMean = s.ErrTotal.Mean
+		perfdata.ErrTotalStddev = s.ErrTotal.Stddev
+		perfdata.ErrTotalCI95 = s.ErrTotal.CI95
+	}
+}
+
+// Whether the mean number of errors over the trials is over the threshold
+func (s *StepStats) HasErrors(threshold int) bool {
+	return s.ErrTotal.Mean >= float64(threshold)
+}
@@ -0,0 +1,60 @@
+package main
+
+import "math"
+import "testing"
+
+func TestComputeStats(t *testing.T) {
+	stats := ComputeStats([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+
+	if stats.N != 8 {
+		t.Errorf("Expected 8 samples, got %d", stats.N)
+	}
+	if stats.Mean != 5 {
+		t.Errorf("Expected a mean of 5, got %f", stats.Mean)
+	}
+	if math.Abs(stats.Stddev-2.138) > 0.001 {
+		t.Errorf("Expected a standard deviation of 2.138, got %f", stats.Stddev)
+	}
+
+	// t(7) = 2.365, so the interval is 2.365 * 2.138 / sqrt(8)
+	if math.Abs(stats.CI95-1.788) > 0.001 {
+		t.Errorf("Expected a confidence interval of 1.788, got %f", stats.CI95)
+	}
+
+	single := ComputeStats([]float64{3})
+	if single.Mean != 3 || single.Stddev != 0 || single.CI95 != 0 {
+		t.Errorf("Expected a single sample to have no spread, got %v", single)
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	kept := RejectOutliers([]float64{100, 102, 98, 101, 99, 250}, 3)
+	if len(kept) != 5 {
+		t.Errorf("Expected the outlier to be rejected, got %v", kept)
+	}
+	for _, value := range kept {
+		if value == 250 {
+			t.Errorf("Expected 250 to be rejected, got %v", kept)
+		}
+	}
+
+	same := RejectOutliers([]float64{5, 5, 5}, 3)
+	if len(same) != 3 {
+		t.Errorf("Expected identical values to be kept, got %v", same)
+	}
+}
+
+func TestStepStatsKeepErrors(t *testing.T) {
+	trials := make([][]*PerfData, 0)
+	for _, errors := range []float64{1, 2, 3, 2, 500} {
+		trials = append(trials, []*PerfData{&PerfData{ConnectionsPerSecond: 100, ErrTotal: errors}})
+	}
+
+	stats := ComputeStepStats(trials, 3)
+	if stats.ErrTotal.Mean != 101.6 {
+		t.Errorf("Expected the error spike to count towards the mean, got %f", stats.ErrTotal.Mean)
+	}
+	if !stats.HasErrors(100) {
+		t.Errorf("Expected the step to be over an error threshold of 100")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import "sync"
+import "time"
+
+// The state of a worker's benchmark calls
+type WorkerStatus struct {
+	Label     string
+	Group     string
+	State     string // "idle", "running", "done" or "failed"
+	Started   int64  // Our clock (ns) when the current or last call started
+	Finished  int64  // Our clock (ns) when it finished, or 0 while running
+	Calls     int    // The number of benchmark calls made
+	Failures  int    // The number of calls that failed over RPC
+	LastError string // The RPC error of the last call, if it failed
+}
+
+// The number of seconds the current or last call has taken so far
+func (w *WorkerStatus) Elapsed() float64 {
+	if w.Started == 0 {
+		return 0
+	}
+	finished := w.Finished
+	if finished == 0 {
+		finished = time.Nanoseconds()
+	}
+	return float64(finished-w.Started) / 1000000000
+}
+
+// The combined results of a step, kept so recent steps can be shown
+type StepResult struct {
+	Target     string
+	Step       int
+	Rate       int
+	Throughput float64 // Connections per second
+	Latency    float64 // Reply time in ms
+	Errors     float64
+}
+
+// The number of recent steps kept in the status
+const statusHistory = 20
+
+// A copy of the coordinator's progress at one moment
+type StatusSnapshot struct {
+	Phase  string
+	Mode   string
+	Target string
+	Step   int
+	Rate   int // The offered rate (or clients) of the current step
+
+	// The rates of every step of the phase, when they are known in advance,
+	// or nil for a stress test, which carries on until the server fails
+	Schedule []int
+
+	// When the current benchmark was requested, on our clock (ns), and how
+	// long it is expected to run in seconds, or 0 if that isn't known
+	BenchmarkStarted int64
+	BenchmarkLength  int
+
+	// The stress test state: whether it's in an error state, and how many
+	// more cooldown steps it will take before stopping
+	ErrorState bool
+	Cooldown   int
+
+	Workers []WorkerStatus
+	Latest  []*PerfData  // The results of the last step written
+	History []StepResult // The most recent steps of the phase, oldest first
+}
+
+// The progress of the coordinator, updated as the benchmark runs and read
+// by anything reporting on it at the same time, such as the metrics
+// endpoint.
+type Status struct {
+	lock    sync.Mutex
+	current StatusSnapshot
+	workers map[string]*WorkerStatus
+	order   []string
+}
+
+func NewStatus() *Status {
+	return &Status{workers: make(map[string]*WorkerStatus)}
+}
+
+// The status of the coordinator of this process
+var coordinator = NewStatus()
+
+// Register the workers, in order, so they are reported before they are used
+func (s *Status) SetWorkers(workers []*Worker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, worker := range workers {
+		if _, ok := s.workers[worker.id]; !ok {
+			s.workers[worker.id] = &WorkerStatus{Label: worker.label, Group: worker.group, State: "idle"}
+			s.order = append(s.order, worker.id)
+		}
+	}
+}
+
+func (s *Status) SetPhase(phase *Phase) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current.Phase = phase.Name
+	s.current.Mode = phase.Mode
+	s.current.Target = phase.target
+	s.current.Step = 0
+	s.current.Rate = 0
+	s.current.ErrorState = false
+	s.current.Cooldown = phase.Cooldown
+	s.current.Schedule = nil
+	s.current.History = nil
+}
+
+// Record the rates the phase will step through
+func (s *Status) SetSchedule(rates []int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current.Schedule = rates
+}
+
+// Record the start of a step of the given phase at the given rate
+func (s *Status) SetStep(phase *Phase, step int, rate int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current.Target = phase.target
+	s.current.Step = step
+	s.current.Rate = rate
+}
+
+// Record the stress test state of the given phase. Each target of a phase
+// has its own state, so the target is set along with it.
+func (s *Status) SetStressState(phase *Phase, errorState bool, cooldown int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current.Target = phase.target
+	s.current.ErrorState = errorState
+	s.current.Cooldown = cooldown
+}
+
+// Record the start of a benchmark with the given arguments
+func (s *Status) SetBenchmark(args *Args) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	length := args.Duration
+	if length <= 0 && args.ConnectionRate > 0 {
+		length = args.NumConnections / args.ConnectionRate
+	}
+
+	s.current.BenchmarkStarted = time.Nanoseconds()
+	s.current.BenchmarkLength = length
+}
+
+// Keep the results of the last step written, and add them to the recent
+// steps of the phase
+func (s *Status) Record(data []*PerfData) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current.Latest = data
+
+	for _, point := range CapacityPoints(data) {
+		result := StepResult{s.current.Target, s.current.Step, point.Rate, point.Throughput, point.Latency, point.Errors}
+		s.current.History = append(s.current.History, result)
+	}
+	if len(s.current.History) > statusHistory {
+		s.current.History = s.current.History[len(s.current.History)-statusHistory:]
+	}
+}
+
+func (s *Status) worker(w *Worker) *WorkerStatus {
+	status, ok := s.workers[w.id]
+	if !ok {
+		status = &WorkerStatus{Label: w.label, Group: w.group}
+		s.workers[w.id] = status
+		s.order = append(s.order, w.id)
+	}
+	return status
+}
+
+func (s *Status) WorkerStarted(w *Worker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := s.worker(w)
+	status.State = "running"
+	status.Started = time.Nanoseconds()
+	status.Finished = 0
+	status.Calls++
+}
+
+// Record the end of a worker's call. An RPC error counts against the
+// worker's health; a benchmark that merely couldn't be parsed does not.
+func (s *Status) WorkerFinished(w *Worker, rpcError string, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := s.worker(w)
+	status.Finished = time.Nanoseconds()
+	status.State = "done"
+
+	status.LastError = rpcError
+	if rpcError != "" {
+		status.Failures++
+		failed = true
+	}
+	if failed {
+		status.State = "failed"
+	}
+}
+
+// A copy of the current status, safe to use without holding the lock
+func (s *Status) Snapshot() *StatusSnapshot {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snapshot := s.current
+	snapshot.Schedule = append([]int(nil), s.current.Schedule...)
+	snapshot.History = append([]StepResult(nil), s.current.History...)
+	snapshot.Workers = make([]WorkerStatus, 0, len(s.order))
+	for _, id := range s.order {
+		snapshot.Workers = append(snapshot.Workers, *s.workers[id])
+	}
+	return &snapshot
+}
@@ -0,0 +1,137 @@
+package main
+
+import "fmt"
+import "log"
+import "os"
+import "rand"
+import "strconv"
+import "strings"
+import "time"
+
+// A single combination of the values of a parameter sweep
+type SweepPoint struct {
+	URL      string
+	Rate     int
+	Requests int
+}
+
+// Parse a comma-separated list of positive integers, e.g. "100,200,400"
+func ParseIntList(spec string) ([]int, os.Error) {
+	values := make([]int, 0, 4)
+
+	for _, entry := range strings.Split(spec, ",", -1) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		value, err := strconv.Atoi(entry)
+		if err != nil || value <= 0 {
+			return nil, os.NewError(fmt.Sprintf("'%s' is not a positive integer", entry))
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// Split a comma-separated list of URLs, skipping empty entries
+func ParseURLList(spec string) []string {
+	urls := make([]string, 0, 4)
+	for _, entry := range strings.Split(spec, ",", -1) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			urls = append(urls, entry)
+		}
+	}
+	return urls
+}
+
+// The cartesian product of the values of each sweep dimension. The rate
+// varies fastest and the URL slowest.
+func SweepPoints(urls []string, rates []int, requests []int) []SweepPoint {
+	points := make([]SweepPoint, 0, len(urls)*len(rates)*len(requests))
+	for _, url := range urls {
+		for _, reqs := range requests {
+			for _, rate := range rates {
+				points = append(points, SweepPoint{url, rate, reqs})
+			}
+		}
+	}
+	return points
+}
+
+// Shuffle the points of a sweep with the given seed, so that an ordering can
+// be reproduced.
+func ShuffleSweep(points []SweepPoint, seed int64) []SweepPoint {
+	rand.Seed(seed)
+
+	shuffled := make([]SweepPoint, len(points))
+	for idx, from := range rand.Perm(len(points)) {
+		shuffled[idx] = points[from]
+	}
+	return shuffled
+}
+
+// Run a benchmark for every combination of the URLs, connection rates and
+// requests per connection listed for the phase. Each combination is one
+// step, and its rows are labelled with the values of the sweep dimensions.
+func SweepTest(workers []*Worker, phase *Phase) []*PerfData {
+	points := phase.sweep
+	if phase.SweepOrder == "random" {
+		seed := phase.SweepSeed
+		if seed == 0 {
+			seed = time.Nanoseconds()
+		}
+		log.Printf("Running the sweep in random order with seed %d", seed)
+		points = ShuffleSweep(points, seed)
+	}
+
+	schedule := make([]int, len(points))
+	for idx, point := range points {
+		schedule[idx] = point.Rate
+	}
+	coordinator.SetSchedule(schedule)
+
+	all := make([]*PerfData, 0)
+
+	for idx, point := range points {
+		log.Printf("Sweep %d of %d: url %s, rate %d, %d requests per connection",
+			idx+1, len(points), point.URL, point.Rate, point.Requests)
+
+		numconns := phase.Duration * point.Rate
+		if numconns <= 0 {
+			numconns = phase.NumConnections
+		}
+
+		args := phase.NewArgs(numconns, point.Rate)
+		coordinator.SetStep(phase, idx+1, point.Rate)
+		args.RequestsPerConnection = point.Requests
+
+		// A swept URL replaces the URL mix of the phase
+		if len(phase.sweepURLs) > 0 {
+			args.URL = point.URL
+			args.WorkLog = nil
+		}
+
+		data, ok := RunDistributedBenchmark(workers, args)
+		if !ok {
+			log.Printf("Sweep %d did not fully succeed", idx+1)
+		}
+
+		for _, perfdata := range data {
+			perfdata.SweepURL = point.URL
+			perfdata.SweepRate = point.Rate
+			perfdata.SweepRequests = point.Requests
+		}
+
+		phase.Tag(data, idx+1)
+		WriteResults(data)
+		all = append(all, data...)
+
+		if idx < len(points)-1 {
+			phase.Pause()
+		}
+	}
+
+	return all
+}
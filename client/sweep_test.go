@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+import "testing"
+
+func TestParseIntList(t *testing.T) {
+	values, err := ParseIntList(" 100, 200,,400 ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.String())
+	}
+
+	expected := []int{100, 200, 400}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(values))
+	}
+	for idx, value := range expected {
+		if values[idx] != value {
+			t.Errorf("Value %d: expected %d, got %d", idx, value, values[idx])
+		}
+	}
+
+	for _, spec := range []string{"100,abc", "100,-5", "0"} {
+		if _, err := ParseIntList(spec); err == nil {
+			t.Errorf("Expected an error parsing '%s'", spec)
+		}
+	}
+}
+
+func TestSweepPoints(t *testing.T) {
+	points := SweepPoints([]string{"/a", "/b"}, []int{100, 200, 300}, []int{1, 10})
+	if len(points) != 12 {
+		t.Fatalf("Expected 12 points, got %d", len(points))
+	}
+
+	// The rate varies fastest, then the requests, then the URL
+	first, second, last := points[0], points[1], points[11]
+	if first.URL != "/a" || first.Rate != 100 || first.Requests != 1 {
+		t.Errorf("Unexpected first point %v", first)
+	}
+	if second.URL != "/a" || second.Rate != 200 || second.Requests != 1 {
+		t.Errorf("Unexpected second point %v", second)
+	}
+	if last.URL != "/b" || last.Rate != 300 || last.Requests != 10 {
+		t.Errorf("Unexpected last point %v", last)
+	}
+}
+
+func TestShuffleSweep(t *testing.T) {
+	points := SweepPoints([]string{"/a", "/b"}, []int{100, 200, 300}, []int{1, 10})
+
+	shuffled := ShuffleSweep(points, 42)
+	if len(shuffled) != len(points) {
+		t.Fatalf("Expected %d points, got %d", len(points), len(shuffled))
+	}
+
+	// Every point appears exactly once, and the same seed gives the same order
+	counts := make(map[string]int)
+	for _, point := range shuffled {
+		counts[fmt.Sprint(point)]++
+	}
+	for _, point := range points {
+		if counts[fmt.Sprint(point)] != 1 {
+			t.Errorf("Point %v appears %d times", point, counts[fmt.Sprint(point)])
+		}
+	}
+
+	again := ShuffleSweep(points, 42)
+	for idx := range shuffled {
+		if again[idx].URL != shuffled[idx].URL || again[idx].Rate != shuffled[idx].Rate ||
+			again[idx].Requests != shuffled[idx].Requests {
+			t.Errorf("Point %d differs between shuffles with the same seed", idx)
+		}
+	}
+}
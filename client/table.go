@@ -0,0 +1,86 @@
+package main
+
+import "bufio"
+import "fmt"
+import "io"
+import "os"
+import "strings"
+
+// A CSV file of results as written by WriteTSVHeader and WriteTSVParseData,
+// read back as strings. Columns are looked up by name, so files written by
+// older versions with fewer columns can still be read.
+type Table struct {
+	Header []string
+	Rows   [][]string
+	index  map[string]int
+}
+
+// Read a CSV file of results. The first line must be the header.
+func ReadTable(r io.Reader) (*Table, os.Error) {
+	reader := bufio.NewReader(r)
+	table := &Table{index: make(map[string]int)}
+
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != os.EOF {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			fields := strings.Split(line, ",", -1)
+
+			if table.Header == nil {
+				table.Header = fields
+				for idx, name := range fields {
+					table.index[name] = idx
+				}
+			} else if len(fields) != len(table.Header) {
+				return nil, os.NewError(fmt.Sprintf("Line %d has %d columns, expected %d", lineNum, len(fields), len(table.Header)))
+			} else {
+				table.Rows = append(table.Rows, fields)
+			}
+		}
+
+		if err == os.EOF {
+			break
+		}
+	}
+
+	if table.Header == nil {
+		return nil, os.NewError("No header found")
+	}
+
+	return table, nil
+}
+
+// Read a CSV file of results from disk
+func ReadTableFile(filename string) (*Table, os.Error) {
+	file, err := os.Open(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table, err := ReadTable(file)
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("Error reading %s: %s", filename, err.String()))
+	}
+	return table, nil
+}
+
+// Whether the table has the named column
+func (t *Table) Has(column string) bool {
+	_, ok := t.index[column]
+	return ok
+}
+
+// The value of the named column in a row, or an empty string if the table
+// does not have that column.
+func (t *Table) String(row []string, column string) string {
+	idx, ok := t.index[column]
+	if !ok {
+		return ""
+	}
+	return row[idx]
+}
@@ -0,0 +1,139 @@
+package main
+
+import "fmt"
+import "log"
+import "os"
+import "strconv"
+import "strings"
+
+// One of the servers benchmarked by a multi-target stress test
+type Target struct {
+	Label string
+	Host  string
+	Port  int
+}
+
+// Parse a list of targets such as "old=10.0.0.1:80,new=10.0.0.2:8080". The
+// label is optional and defaults to the address, and a target without a port
+// uses defaultPort.
+func ParseTargets(spec string, defaultPort int) ([]Target, os.Error) {
+	targets := make([]Target, 0, 2)
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",", -1) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		label, addr := entry, entry
+		if sep := strings.Index(entry, "="); sep >= 0 {
+			label, addr = entry[:sep], entry[sep+1:]
+		}
+
+		target := Target{label, addr, defaultPort}
+		if sep := strings.LastIndex(addr, ":"); sep >= 0 {
+			port, err := strconv.Atoi(addr[sep+1:])
+			if err != nil || port <= 0 {
+				return nil, os.NewError(fmt.Sprintf("Target '%s' has an invalid port", entry))
+			}
+			target.Host, target.Port = addr[:sep], port
+		}
+
+		if label == "" || target.Host == "" {
+			return nil, os.NewError(fmt.Sprintf("Target '%s' needs a label and a host", entry))
+		}
+		if seen[label] {
+			return nil, os.NewError(fmt.Sprintf("Target label '%s' is used more than once", label))
+		}
+		seen[label] = true
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// A copy of the phase for each of its targets, or the phase itself if it
+// only has the one.
+func (p *Phase) TargetPhases() []*Phase {
+	if len(p.targets) == 0 {
+		return []*Phase{p}
+	}
+
+	phases := make([]*Phase, 0, len(p.targets))
+	for _, target := range p.targets {
+		tp := *p
+		tp.Host = target.Host
+		tp.Port = target.Port
+		tp.target = target.Label
+		phases = append(phases, &tp)
+	}
+	return phases
+}
+
+// The name of the phase, along with its target if it has one
+func (p *Phase) Title() string {
+	if p.target == "" {
+		return p.Name
+	}
+	return fmt.Sprintf("%s (target %s)", p.Name, p.target)
+}
+
+// The percentage change from a to b, or 0 if a is zero
+func percentOf(a float64, b float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return (b - a) / a * 100
+}
+
+// Log the capacity found for each target of a stress test side by side: the
+// summary figures first, then the throughput, reply time and errors of each
+// target at every rate they were all measured at. Changes are relative to
+// the first target.
+func CompareTargets(capacities []*Capacity) {
+	if len(capacities) < 2 {
+		return
+	}
+
+	base := capacities[0]
+	log.Printf("Comparison of targets, relative to %s:", base.Target)
+
+	for _, capacity := range capacities {
+		log.Printf("  %s: no errors up to rate %d, knee at rate %d, peak %.1f conn/s (%+.1f%%) at rate %d",
+			capacity.Target, capacity.MaxErrorFreeRate, capacity.KneeRate, capacity.PeakThroughput,
+			percentOf(base.PeakThroughput, capacity.PeakThroughput), capacity.PeakThroughputRate)
+	}
+
+	// Index the points of each target by rate
+	points := make([]map[int]CapacityPoint, len(capacities))
+	for idx, capacity := range capacities {
+		points[idx] = make(map[int]CapacityPoint)
+		for _, point := range capacity.Points {
+			points[idx][point.Rate] = point
+		}
+	}
+
+	for _, point := range base.Points {
+		line := fmt.Sprintf("  Rate %d: %s %.1f conn/s %.1f ms %.0f errors", point.Rate,
+			base.Target, point.Throughput, point.Latency, point.Errors)
+
+		complete := true
+		for idx := 1; idx < len(capacities); idx++ {
+			other, ok := points[idx][point.Rate]
+			if !ok {
+				complete = false
+				break
+			}
+			line += fmt.Sprintf(" | %s %.1f conn/s (%+.1f%%) %.1f ms (%+.1f%%) %.0f errors",
+				capacities[idx].Target,
+				other.Throughput, percentOf(point.Throughput, other.Throughput),
+				other.Latency, percentOf(point.Latency, other.Latency), other.Errors)
+		}
+
+		if complete {
+			log.Print(line)
+		}
+	}
+}
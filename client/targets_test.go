@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets("old=10.0.0.1:8080, new=10.0.0.2,10.0.0.3:81", 80)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.String())
+	}
+
+	expected := []Target{
+		Target{"old", "10.0.0.1", 8080},
+		Target{"new", "10.0.0.2", 80},
+		Target{"10.0.0.3:81", "10.0.0.3", 81},
+	}
+
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, got %d", len(expected), len(targets))
+	}
+	for idx, target := range expected {
+		got := targets[idx]
+		if got.Label != target.Label || got.Host != target.Host || got.Port != target.Port {
+			t.Errorf("Target %d: expected %v, got %v", idx, target, got)
+		}
+	}
+
+	for _, spec := range []string{"a=host:x", "=host:80", "a=host:80,a=other:80"} {
+		if _, err := ParseTargets(spec, 80); err == nil {
+			t.Errorf("Expected an error parsing '%s'", spec)
+		}
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	if change := percentOf(200, 150); change != -25 {
+		t.Errorf("Expected -25%%, got %f", change)
+	}
+	if change := percentOf(0, 150); change != 0 {
+		t.Errorf("Expected 0%% from a zero base, got %f", change)
+	}
+}
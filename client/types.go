@@ -10,22 +10,101 @@ type Args struct {
 	ConnectionRate        int
 	RequestsPerConnection int
 	Duration              int
+	WorkLog               []string // A sequence of URIs to replay instead of URL
+	Concurrency           int      // Clients to keep busy (closed loop), or 0 for httperf
+	Timeout               int      // Seconds a closed-loop client waits for a reply, 0 for no limit
+}
+
+// Returns a copy of the arguments with the number of connections, the
+// connection rate and the concurrency scaled down to the given share of the
+// whole benchmark.
+func (a *Args) Divide(share float64) *Args {
+	wargs := *a
+	wargs.NumConnections = scaleCount(a.NumConnections, share)
+	wargs.ConnectionRate = scaleCount(a.ConnectionRate, share)
+	wargs.Concurrency = scaleCount(a.Concurrency, share)
+
+	// A worker with no clients of its own would fall back to httperf
+	if a.Concurrency > 0 && wargs.Concurrency == 0 {
+		wargs.Concurrency = 1
+	}
+	return &wargs
+}
+
+// Scale a count by the given share, rounding down. The small tolerance keeps
+// even splits such as 300 * 1/3 from rounding down to 99.
+func scaleCount(count int, share float64) int {
+	return int(float64(count)*share + 1e-6)
 }
 
 type Result struct {
 	Stdout     string
 	Stderr     string
 	ExitStatus int
+	Started    int64 // Worker clock (ns) when the benchmark process started
+	Finished   int64 // Worker clock (ns) when the benchmark process exited
+}
+
+type Clock struct {
+	Nanoseconds int64
 }
 
 type Worker struct {
-	addr   string // The address of the RPC worker client
-	id     string // A string UID for this worker
-	client *rpc.Client
-	result *Result   // The pending RPC result
-	call   *rpc.Call // The pending RPC call result
-	date   int64     // The time the pending call was started
-	args   *Args     // The arguments passed to the pending call
+	addr     string  // The address of the RPC worker client
+	id       string  // A string UID for this worker
+	label    string  // A human readable name, included in every output row
+	group    string  // The group this worker belongs to, e.g. a rack or region
+	weight   float64 // The relative share of each benchmark this worker takes
+	notes    string
+	workload *GroupSpec // The workload of this worker's group, if any
+	client   *rpc.Client
+	result   *Result   // The pending RPC result
+	call     *rpc.Call // The pending RPC call result
+	date     int64     // The time the pending call was started
+	args     *Args     // The arguments passed to the pending call
+	offset   int64     // Estimated offset (ns) of the worker clock from ours
+	rtt      int64     // Round-trip time (ns) of the best clock sample
+
+	started  int64 // Our clock (ns) when the pending call was started
+	finished int64 // Our clock (ns) when the pending call completed, or 0
+	exited   int64 // Our clock (ns) when the benchmark exited on the worker, or 0
+}
+
+// The number of seconds between starting the pending call and its
+// completion being collected.
+func (w *Worker) Elapsed() float64 {
+	return float64(w.finished-w.started) / 1000000000
+}
+
+// The number of seconds between starting the pending call and the benchmark
+// exiting on the worker, which leaves out the time taken to send the
+// results back. Falls back to Elapsed if the worker didn't say when it
+// exited.
+func (w *Worker) RunTime() float64 {
+	if w.exited == 0 {
+		return w.Elapsed()
+	}
+	return float64(w.exited-w.started) / 1000000000
+}
+
+// The load offered by the benchmark that produced this data, which is the
+// number of clients of a closed-loop benchmark, or the connection rate.
+func (d *PerfData) OfferedLoad() int {
+	if d.ArgConcurrency > 0 {
+		return d.ArgConcurrency
+	}
+	return d.ArgConnectionRate
+}
+
+// The load offered by every worker of the benchmark together. Results
+// written before it was recorded only have the load of each worker, which
+// is summed over the workers of an aggregate, but may be less than the
+// benchmark asked for when it was split.
+func (d *PerfData) StepLoad() int {
+	if d.TotalOfferedLoad > 0 {
+		return d.TotalOfferedLoad
+	}
+	return d.OfferedLoad()
 }
 
 type PerfData struct {
@@ -33,6 +112,15 @@ type PerfData struct {
 	// from the parsed performance data
 	BenchmarkId              string
 	BenchmarkDate            int64
+	Phase                    string
+	Target                   string // The label of the target, when there are several
+	Step                     int    // The step or window within the phase
+	Trial                    int    // The trial of the step, when repeated
+	Warmup                   bool   // Set for results of an unmeasured warmup
+	Spike                    bool   // Set for results of a spike test burst
+	SweepURL                 string
+	SweepRate                int // The total connection rate of a sweep
+	SweepRequests            int
 	ArgHost                  string
 	ArgPort                  int
 	ArgURL                   string
@@ -40,6 +128,26 @@ type PerfData struct {
 	ArgConnectionRate        int
 	ArgRequestsPerConnection int
 	ArgDuration              int
+	ArgConcurrency           int // The number of closed-loop clients, 0 for open loop
+	TotalOfferedLoad         int // The load of the benchmark over every worker together
+
+	// The worker that produced this data, from the inventory file
+	WorkerLabel string
+	WorkerGroup string
+
+	// The number of seconds between requesting the benchmark from the
+	// worker and collecting its results.
+	WorkerElapsed float64
+
+	// The number of requests made for each URL of a workload mix, e.g.
+	// "/=500 /search?q=x=300", or empty when a single URL was requested.
+	URLRequests string
+
+	// Statistics of the key metrics over the repeated trials of a step,
+	// computed from the aggregate of each trial
+	ConnectionsPerSecondMean, ConnectionsPerSecondStddev, ConnectionsPerSecondCI95,
+	ReplyTimeResponseMean, ReplyTimeResponseStddev, ReplyTimeResponseCI95,
+	ErrTotalMean, ErrTotalStddev, ErrTotalCI95 float64
 
 	// The following fields all come from the parsed data and should not
 	// need to be changed.
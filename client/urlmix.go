@@ -0,0 +1,168 @@
+package main
+
+import "fmt"
+import "os"
+import "strconv"
+import "strings"
+
+// A URL and its relative weight in a workload mix
+type URLWeight struct {
+	URL    string
+	Weight int
+}
+
+// The number of requests made for a single URL in a workload mix
+type URLCount struct {
+	URL      string
+	Requests int
+}
+
+// Parse a weighted URL list such as "/=50,/search?q=x=30,/img/logo.png=20".
+// The weight follows the last '=' of each entry, so URLs may contain query
+// strings.
+func ParseURLMix(spec string) ([]URLWeight, os.Error) {
+	mix := make([]URLWeight, 0, 4)
+
+	for _, entry := range strings.Split(spec, ",", -1) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		sep := strings.LastIndex(entry, "=")
+		if sep <= 0 {
+			return nil, os.NewError(fmt.Sprintf("URL mix entry '%s' has no weight", entry))
+		}
+
+		weight, err := strconv.Atoi(entry[sep+1:])
+		if err != nil || weight <= 0 {
+			return nil, os.NewError(fmt.Sprintf("URL mix entry '%s' has an invalid weight", entry))
+		}
+
+		url := entry[:sep]
+		if strings.Index(url, " ") >= 0 {
+			return nil, os.NewError(fmt.Sprintf("URL mix entry '%s' contains a space", entry))
+		}
+
+		mix = append(mix, URLWeight{url, weight})
+	}
+
+	if len(mix) == 0 {
+		return nil, os.NewError("URL mix is empty")
+	}
+
+	return mix, nil
+}
+
+// Format a URL mix as a label that is safe to write into a CSV column
+func FormatURLMix(mix []URLWeight) string {
+	parts := make([]string, 0, len(mix))
+	for _, entry := range mix {
+		parts = append(parts, fmt.Sprintf("%s=%d", entry.URL, entry.Weight))
+	}
+	return strings.Join(parts, " ")
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Build the sequence of URIs replayed by each worker. The weights are reduced
+// to their smallest equivalent, and the URLs are interleaved as evenly as
+// possible so that any prefix of the sequence is close to the desired mix.
+func BuildWorkLog(mix []URLWeight) []string {
+	divisor := 0
+	for _, entry := range mix {
+		divisor = gcd(divisor, entry.Weight)
+	}
+
+	weights := make([]int, len(mix))
+	total := 0
+	for idx, entry := range mix {
+		weights[idx] = entry.Weight / divisor
+		total += weights[idx]
+	}
+
+	// Smooth weighted round-robin: each URL earns its weight every round,
+	// and the URL with the most credit is chosen and pays the total back.
+	credit := make([]int, len(mix))
+	sequence := make([]string, 0, total)
+
+	for len(sequence) < total {
+		best := 0
+		for idx := range mix {
+			credit[idx] += weights[idx]
+			if credit[idx] > credit[best] {
+				best = idx
+			}
+		}
+
+		credit[best] -= total
+		sequence = append(sequence, mix[best].URL)
+	}
+
+	return sequence
+}
+
+// Work out how many requests were made for each URL when a worker replayed
+// the sequence in a loop for the given number of requests. The URLs are
+// listed in the order they first appear in the sequence.
+func URLRequestCounts(sequence []string, requests int) []URLCount {
+	counts := make([]URLCount, 0, 4)
+	if len(sequence) == 0 {
+		return counts
+	}
+
+	index := make(map[string]int)
+	rounds := requests / len(sequence)
+	partial := requests % len(sequence)
+
+	for idx, url := range sequence {
+		pos, ok := index[url]
+		if !ok {
+			pos = len(counts)
+			index[url] = pos
+			counts = append(counts, URLCount{url, 0})
+		}
+
+		counts[pos].Requests += rounds
+		if idx < partial {
+			counts[pos].Requests++
+		}
+	}
+
+	return counts
+}
+
+// Add the counts from one worker to a running total
+func addURLCounts(total []URLCount, counts []URLCount) []URLCount {
+	for _, count := range counts {
+		found := false
+		for idx := range total {
+			if total[idx].URL == count.URL {
+				total[idx].Requests += count.Requests
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			total = append(total, count)
+		}
+	}
+
+	return total
+}
+
+// Format per-URL request counts as a label that is safe to write into a CSV
+// column, e.g. "/=500 /search?q=x=300"
+func FormatURLCounts(counts []URLCount) string {
+	parts := make([]string, 0, len(counts))
+	for _, count := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", count.URL, count.Requests))
+	}
+	return strings.Join(parts, " ")
+}
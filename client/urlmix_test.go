@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestParseURLMix(t *testing.T) {
+	mix, err := ParseURLMix("/=50,/search?q=x=30, /img/logo.png=20")
+	if err != nil {
+		t.Fatalf("Failed to parse URL mix: %s", err.String())
+	}
+
+	expected := []URLWeight{{"/", 50}, {"/search?q=x", 30}, {"/img/logo.png", 20}}
+	if len(mix) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(mix))
+	}
+
+	for idx, entry := range expected {
+		if mix[idx].URL != entry.URL || mix[idx].Weight != entry.Weight {
+			t.Errorf("Expected %v for entry %d, got %v", entry, idx, mix[idx])
+		}
+	}
+
+	for _, spec := range []string{"", "/", "/=0", "/=x", "=5"} {
+		if _, err := ParseURLMix(spec); err == nil {
+			t.Errorf("Expected an error parsing %q", spec)
+		}
+	}
+}
+
+func TestBuildWorkLog(t *testing.T) {
+	mix := []URLWeight{{"/a", 50}, {"/b", 30}, {"/c", 20}}
+	sequence := BuildWorkLog(mix)
+
+	if len(sequence) != 10 {
+		t.Fatalf("Expected the weights to reduce to 10 entries, got %d", len(sequence))
+	}
+
+	counts := URLRequestCounts(sequence, len(sequence))
+	for idx, count := range counts {
+		if count.URL != mix[idx].URL || count.Requests != mix[idx].Weight/10 {
+			t.Errorf("Expected %s=%d, got %s=%d", mix[idx].URL, mix[idx].Weight/10, count.URL, count.Requests)
+		}
+	}
+
+	// The URLs should be interleaved, not grouped together
+	if sequence[0] == sequence[1] {
+		t.Errorf("Expected an interleaved sequence, got %v", sequence)
+	}
+}
+
+func TestURLRequestCounts(t *testing.T) {
+	sequence := []string{"/a", "/b", "/a", "/c"}
+	counts := URLRequestCounts(sequence, 10)
+
+	expected := []URLCount{{"/a", 5}, {"/b", 3}, {"/c", 2}}
+	for idx, count := range expected {
+		if counts[idx].URL != count.URL || counts[idx].Requests != count.Requests {
+			t.Errorf("Expected %v, got %v", count, counts[idx])
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "sort"
+
+// Gunther's Universal Scalability Law, which models the throughput X at a
+// load N as
+//
+//	X(N) = lambda N / (1 + sigma (N - 1) + kappa N (N - 1))
+//
+// where sigma is the cost of contention (serialisation) and kappa the cost of
+// coherency (crosstalk). Amdahl's law is the special case where kappa is zero.
+type USLModel struct {
+	Lambda float64 // The throughput of a single unit of load
+	Sigma  float64 // The contention coefficient
+	Kappa  float64 // The coherency coefficient
+	Amdahl bool    // Set if kappa was fixed at zero
+
+	// The load at which throughput peaks and the throughput there. With
+	// Amdahl's law throughput never peaks, but approaches lambda / sigma.
+	PeakLoad       float64
+	PeakThroughput float64
+
+	Points int // The number of points the model was fitted to
+}
+
+// The throughput the model predicts at the given load
+func (m *USLModel) Throughput(load float64) float64 {
+	return m.Lambda * load / (1 + m.Sigma*(load-1) + m.Kappa*load*(load-1))
+}
+
+// Fit the Universal Scalability Law to a set of points, using the offered
+// rate as the load. The model can be rearranged as
+//
+//	N / X(N) = a + b N + c N^2
+//
+// with a = (1 - sigma) / lambda, b = (sigma - kappa) / lambda and
+// c = kappa / lambda, which is fitted by least squares, so lambda is fitted
+// along with the other coefficients rather than read off the lowest load.
+// If amdahl is set, or the fit gives a negative kappa, c is fixed at zero.
+func FitUSL(points []CapacityPoint, amdahl bool) (*USLModel, os.Error) {
+	usable := make([]CapacityPoint, 0, len(points))
+	for _, point := range points {
+		if point.Rate > 0 && point.Throughput > 0 {
+			usable = append(usable, point)
+		}
+	}
+
+	if len(usable) < 3 {
+		return nil, os.NewError(fmt.Sprintf("Need at least 3 points with throughput to fit a model, got %d", len(usable)))
+	}
+
+	sort.Sort(capacityPoints(usable))
+
+	model := &USLModel{Points: len(usable), Amdahl: amdahl}
+
+	// The loads are scaled to at most 1 to keep the sums well conditioned
+	scale := float64(usable[len(usable)-1].Rate)
+
+	var a, b, c float64
+	if !amdahl {
+		coef, ok := fitPolynomial(usable, scale, 3)
+		if !ok {
+			return nil, os.NewError("The points do not cover a range of loads")
+		}
+		a, b, c = coef[0], coef[1]/scale, coef[2]/(scale*scale)
+	}
+
+	if amdahl || c < 0 {
+		coef, ok := fitPolynomial(usable, scale, 2)
+		if !ok {
+			return nil, os.NewError("The points do not cover a range of loads")
+		}
+		a, b, c = coef[0], coef[1]/scale, 0
+		model.Amdahl = true
+	}
+
+	if a+b+c <= 0 {
+		return nil, os.NewError("The points do not fit the model")
+	}
+
+	model.Lambda = 1 / (a + b + c)
+	model.Sigma = (b + c) * model.Lambda
+	model.Kappa = c * model.Lambda
+
+	if model.Sigma < 0 {
+		model.Sigma = 0
+	}
+
+	if model.Kappa > 0 {
+		model.PeakLoad = math.Floor(math.Sqrt((1 - model.Sigma) / model.Kappa))
+		model.PeakThroughput = model.Throughput(model.PeakLoad)
+	} else if model.Sigma > 0 {
+		model.PeakLoad = math.Inf(1)
+		model.PeakThroughput = model.Lambda / model.Sigma
+	} else {
+		model.PeakLoad = math.Inf(1)
+		model.PeakThroughput = math.Inf(1)
+	}
+
+	return model, nil
+}
+
+// Fit N / X(N) by least squares to a polynomial in N / scale with the given
+// number of terms, returning its coefficients from the constant up, or false
+// if the points cannot determine them.
+func fitPolynomial(points []CapacityPoint, scale float64, terms int) ([]float64, bool) {
+	// The normal equations, as an augmented matrix
+	m := make([][]float64, terms)
+	for i := range m {
+		m[i] = make([]float64, terms+1)
+	}
+
+	basis := make([]float64, terms)
+	for _, point := range points {
+		u := float64(point.Rate) / scale
+		y := float64(point.Rate) / point.Throughput
+
+		basis[0] = 1
+		for i := 1; i < terms; i++ {
+			basis[i] = basis[i-1] * u
+		}
+
+		for i := 0; i < terms; i++ {
+			for j := 0; j < terms; j++ {
+				m[i][j] += basis[i] * basis[j]
+			}
+			m[i][terms] += basis[i] * y
+		}
+	}
+
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < terms; col++ {
+		pivot := col
+		for row := col + 1; row < terms; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < terms; row++ {
+			f := m[row][col] / m[col][col]
+			for k := col; k <= terms; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+
+	coef := make([]float64, terms)
+	for row := terms - 1; row >= 0; row-- {
+		sum := m[row][terms]
+		for k := row + 1; k < terms; k++ {
+			sum -= m[row][k] * coef[k]
+		}
+		coef[row] = sum / m[row][row]
+	}
+
+	return coef, true
+}
+
+// A one line description of a fitted model
+func (m *USLModel) String() string {
+	law := "USL"
+	if m.Amdahl {
+		law = "Amdahl"
+	}
+
+	peak := fmt.Sprintf("peak %.1f conn/s at rate %.0f", m.PeakThroughput, m.PeakLoad)
+	if math.IsInf(m.PeakLoad, 1) {
+		peak = fmt.Sprintf("throughput approaches %.1f conn/s", m.PeakThroughput)
+	}
+
+	return fmt.Sprintf("%s fit over %d points: lambda %.4f, sigma (contention) %.6f, kappa (coherency) %.8f, %s",
+		law, m.Points, m.Lambda, m.Sigma, m.Kappa, peak)
+}
+
+// Fit a model to the points of a stress test and log it
+func ReportUSL(points []CapacityPoint, phase *Phase) {
+	model, err := FitUSL(points, *amdahl)
+	if err != nil {
+		log.Printf("Could not fit a scalability model for phase %s: %s", phase.Title(), err.String())
+		return
+	}
+
+	log.Printf("Phase %s: %s", phase.Title(), model)
+}
+
+// Reduce a set of stored results to one point per rate. Each benchmark
+// (identified by its BenchmarkId) is first combined over its workers, then
+// any benchmarks at the same rate, such as repeated trials, are averaged.
+// Warmup results are ignored.
+func BenchmarkPoints(data []*PerfData) []CapacityPoint {
+	benchmarks := make(map[string][]*PerfData)
+	order := make([]string, 0)
+
+	for _, perfdata := range data {
+		if perfdata.Warmup {
+			continue
+		}
+
+		id := perfdata.BenchmarkId
+		if _, ok := benchmarks[id]; !ok {
+			order = append(order, id)
+		}
+		benchmarks[id] = append(benchmarks[id], perfdata)
+	}
+
+	sums := make(map[int]*CapacityPoint)
+	counts := make(map[int]int)
+	points := make([]CapacityPoint, 0)
+
+	for _, id := range order {
+		agg := AggregatePerfData(benchmarks[id])
+		rate := agg.StepLoad()
+
+		sum, ok := sums[rate]
+		if !ok {
+			sum = &CapacityPoint{Rate: rate}
+			sums[rate] = sum
+		}
+
+		sum.Throughput += agg.ConnectionsPerSecond
+		sum.Latency += agg.ReplyTimeResponse
+		sum.Errors += agg.ErrTotal
+		counts[rate]++
+	}
+
+	for rate, sum := range sums {
+		n := float64(counts[rate])
+		points = append(points, CapacityPoint{rate, sum.Throughput / n, sum.Latency / n, sum.Errors / n})
+	}
+
+	sort.Sort(capacityPoints(points))
+	return points
+}
+
+// The results from the given phase, or all of them if phase is empty
+func PhaseResults(data []*PerfData, phase string) []*PerfData {
+	if phase == "" {
+		return data
+	}
+
+	selected := make([]*PerfData, 0)
+	for _, perfdata := range data {
+		if perfdata.Phase == phase {
+			selected = append(selected, perfdata)
+		}
+	}
+	return selected
+}
+
+// The 'fit' subcommand, which fits a scalability model to stored results
+// and prints it along with the points used.
+func RunFit(filenames []string) os.Error {
+	if len(filenames) == 0 {
+		return os.NewError("No result files given to fit")
+	}
+
+	points := make([]CapacityPoint, 0)
+	for _, filename := range filenames {
+		data, err := ReadTSVParseDataFile(filename)
+		if err != nil {
+			return err
+		}
+		points = append(points, BenchmarkPoints(PhaseResults(data, *fitPhase))...)
+	}
+
+	sort.Sort(capacityPoints(points))
+
+	model, err := FitUSL(points, *amdahl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rate,Throughput,ReplyTimeResponse,ErrTotal,Predicted\n")
+	for _, point := range points {
+		fmt.Printf("%d,%.1f,%.1f,%.0f,%.1f\n", point.Rate, point.Throughput, point.Latency, point.Errors,
+			model.Throughput(float64(point.Rate)))
+	}
+
+	fmt.Printf("\n%s\n", model)
+	return nil
+}
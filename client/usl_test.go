@@ -0,0 +1,96 @@
+package main
+
+import "math"
+import "testing"
+
+// Points generated exactly from a known model should give back its
+// coefficients.
+func TestFitUSL(t *testing.T) {
+	known := &USLModel{Lambda: 2, Sigma: 0.05, Kappa: 0.0002}
+
+	points := make([]CapacityPoint, 0)
+	for rate := 1; rate <= 100; rate += 9 {
+		points = append(points, CapacityPoint{rate, known.Throughput(float64(rate)), 0, 0})
+	}
+
+	model, err := FitUSL(points, false)
+	if err != nil {
+		t.Fatalf("Failed to fit: %s", err.String())
+	}
+
+	if math.Abs(model.Lambda-known.Lambda) > 1e-9 {
+		t.Errorf("Expected lambda %f, got %f", known.Lambda, model.Lambda)
+	}
+	if math.Abs(model.Sigma-known.Sigma) > 1e-6 {
+		t.Errorf("Expected sigma %f, got %f", known.Sigma, model.Sigma)
+	}
+	if math.Abs(model.Kappa-known.Kappa) > 1e-8 {
+		t.Errorf("Expected kappa %f, got %f", known.Kappa, model.Kappa)
+	}
+
+	// sqrt((1 - 0.05) / 0.0002) = 68.9
+	if model.PeakLoad != 68 {
+		t.Errorf("Expected the peak at load 68, got %f", model.PeakLoad)
+	}
+}
+
+// Stress tests start well above a load of 1, so lambda has to be fitted
+// rather than read off the lowest point.
+func TestFitUSLAboveOne(t *testing.T) {
+	known := &USLModel{Lambda: 3, Sigma: 0.02, Kappa: 0.00001}
+
+	points := make([]CapacityPoint, 0)
+	for rate := 100; rate <= 1500; rate += 100 {
+		points = append(points, CapacityPoint{rate, known.Throughput(float64(rate)), 0, 0})
+	}
+
+	model, err := FitUSL(points, false)
+	if err != nil {
+		t.Fatalf("Failed to fit: %s", err.String())
+	}
+
+	if math.Abs(model.Lambda-known.Lambda) > 1e-9 {
+		t.Errorf("Expected lambda %f, got %f", known.Lambda, model.Lambda)
+	}
+	if math.Abs(model.Sigma-known.Sigma) > 1e-9 {
+		t.Errorf("Expected sigma %f, got %f", known.Sigma, model.Sigma)
+	}
+	if math.Abs(model.Kappa-known.Kappa) > 1e-12 {
+		t.Errorf("Expected kappa %f, got %f", known.Kappa, model.Kappa)
+	}
+
+	// sqrt((1 - 0.02) / 0.00001) = 313.0
+	if model.PeakLoad != 313 {
+		t.Errorf("Expected the peak at load 313, got %f", model.PeakLoad)
+	}
+}
+
+func TestFitAmdahl(t *testing.T) {
+	known := &USLModel{Lambda: 1, Sigma: 0.1}
+
+	points := make([]CapacityPoint, 0)
+	for rate := 1; rate <= 50; rate += 7 {
+		points = append(points, CapacityPoint{rate, known.Throughput(float64(rate)), 0, 0})
+	}
+
+	model, err := FitUSL(points, true)
+	if err != nil {
+		t.Fatalf("Failed to fit: %s", err.String())
+	}
+
+	if !model.Amdahl || model.Kappa != 0 {
+		t.Errorf("Expected an Amdahl fit, got %v", model)
+	}
+	if math.Abs(model.Sigma-0.1) > 1e-6 {
+		t.Errorf("Expected sigma 0.1, got %f", model.Sigma)
+	}
+	if math.Abs(model.PeakThroughput-10) > 1e-4 {
+		t.Errorf("Expected throughput to approach 10, got %f", model.PeakThroughput)
+	}
+}
+
+func TestFitTooFewPoints(t *testing.T) {
+	if _, err := FitUSL([]CapacityPoint{{100, 100, 0, 0}}, false); err == nil {
+		t.Errorf("Expected an error fitting a single point")
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import "fmt"
 import "io"
-import "log"
+import "os"
+import "strconv"
 import "strings"
 import "reflect"
 
 // The 'Raw' field is omitted here, since all of the data is already included
-var fieldNames = []string{"BenchmarkId", "BenchmarkDate", "ArgHost", "ArgPort", "ArgURL", "ArgNumConnections", "ArgConnectionRate", "ArgRequestsPerConnection", "ArgDuration", "ConnectionBurstLength", "TotalConnections", "TotalRequests", "TotalReplies", "TestDuration", "ConnectionsPerSecond", "MsPerConnection", "ConcurrentConnections", "ConnectionTimeMin", "ConnectionTimeAvg", "ConnectionTimeMax", "ConnectionTimeMedian", "ConnectionTimeStddev", "ConnectionTimeConnect", "RepliesPerConnection", "RequestsPerSecond", "MsPerRequest", "RequestSize", "RepliesPerSecMin", "RepliesPerSecAvg", "RepliesPerSecMax", "RepliesPerSecStddev", "RepliesPerSecNumSamples", "ReplyTimeResponse", "ReplyTimeTransfer", "ReplySizeHeader", "ReplySizeContent", "ReplySizeFooter", "ReplySizeTotal", "ReplyStatus_1xx", "ReplyStatus_2xx", "ReplyStatus_3xx", "ReplyStatus_4xx", "ReplyStatus_5xx", "CpuTimeUser", "CpuTimeSystem", "CpuPercUser", "CpuPercSystem", "CpuPercTotal", "NetIOValue", "NetIOUnit", "NetIOBytesPerSecond", "ErrTotal", "ErrClientTimeout", "ErrSocketTimeout", "ErrConnectionRefused", "ErrConnectionReset", "ErrFdUnavail", "ErrAddRunAvail", "ErrFtabFull", "ErrOther"}
+var fieldNames = []string{"BenchmarkId", "BenchmarkDate", "Phase", "Target", "Step", "Trial", "Warmup", "Spike", "SweepURL", "SweepRate", "SweepRequests", "ArgHost", "ArgPort", "ArgURL", "ArgNumConnections", "ArgConnectionRate", "ArgRequestsPerConnection", "ArgDuration", "ArgConcurrency", "TotalOfferedLoad", "WorkerLabel", "WorkerGroup", "WorkerElapsed", "URLRequests", "ConnectionsPerSecondMean", "ConnectionsPerSecondStddev", "ConnectionsPerSecondCI95", "ReplyTimeResponseMean", "ReplyTimeResponseStddev", "ReplyTimeResponseCI95", "ErrTotalMean", "ErrTotalStddev", "ErrTotalCI95", "ConnectionBurstLength", "TotalConnections", "TotalRequests", "TotalReplies", "TestDuration", "ConnectionsPerSecond", "MsPerConnection", "ConcurrentConnections", "ConnectionTimeMin", "ConnectionTimeAvg", "ConnectionTimeMax", "ConnectionTimeMedian", "ConnectionTimeStddev", "ConnectionTimeConnect", "RepliesPerConnection", "RequestsPerSecond", "MsPerRequest", "RequestSize", "RepliesPerSecMin", "RepliesPerSecAvg", "RepliesPerSecMax", "RepliesPerSecStddev", "RepliesPerSecNumSamples", "ReplyTimeResponse", "ReplyTimeTransfer", "ReplySizeHeader", "ReplySizeContent", "ReplySizeFooter", "ReplySizeTotal", "ReplyStatus_1xx", "ReplyStatus_2xx", "ReplyStatus_3xx", "ReplyStatus_4xx", "ReplyStatus_5xx", "CpuTimeUser", "CpuTimeSystem", "CpuPercUser", "CpuPercSystem", "CpuPercTotal", "NetIOValue", "NetIOUnit", "NetIOBytesPerSecond", "ErrTotal", "ErrClientTimeout", "ErrSocketTimeout", "ErrConnectionRefused", "ErrConnectionReset", "ErrFdUnavail", "ErrAddRunAvail", "ErrFtabFull", "ErrOther"}
 
 // Write a CSV header to the given writer including each of the field names
 // above, and an optional list of additional column names specified. In the
@@ -35,13 +36,13 @@ func WriteTSVParseData(w io.Writer, data *PerfData) {
 	// Turn the struct into a Type so we can use reflection
 	ptr, ok := reflect.NewValue(data).(*reflect.PtrValue)
 	if !ok {
-		log.Fatalf("Could not convert results into a pointer value")
+		fatalf("Could not convert results into a pointer value")
 		return
 	}
 
 	val, ok := ptr.Elem().(*reflect.StructValue)
 	if !ok {
-		log.Fatalf("Failed when reflecting on struct")
+		fatalf("Failed when reflecting on struct")
 		return
 	}
 
@@ -51,7 +52,7 @@ func WriteTSVParseData(w io.Writer, data *PerfData) {
 	for _, field := range fieldNames {
 		column := val.FieldByName(field)
 		if column == nil {
-			log.Fatalf("Failed when reflecting field %s", field)
+			fatalf("Failed when reflecting field %s", field)
 		}
 
 		switch t := column.(type) {
@@ -67,8 +68,12 @@ func WriteTSVParseData(w io.Writer, data *PerfData) {
 			ivalue := column.(*reflect.IntValue)
 			icolumn := ivalue.Get()
 			columns = append(columns, fmt.Sprintf("%#v", icolumn))
+		case *reflect.BoolValue:
+			bvalue := column.(*reflect.BoolValue)
+			bcolumn := bvalue.Get()
+			columns = append(columns, fmt.Sprintf("%v", bcolumn))
 		default:
-			log.Fatalf("Got a field we cannot handle: %s", field)
+			fatalf("Got a field we cannot handle: %s", field)
 		}
 	}
 
@@ -76,15 +81,101 @@ func WriteTSVParseData(w io.Writer, data *PerfData) {
 	io.WriteString(w, "\n")
 }
 
-func SetHasErrors(perfdata []*PerfData, threshold int) bool {
-	total := 0
-	for _, data := range perfdata {
-		total = total + int(data.ErrTotal)
+// Read a CSV file written by WriteTSVHeader and WriteTSVParseData back into
+// a set of PerfData. Columns are matched to fields by the names in the
+// header, using the same names as the writer. Unknown columns are skipped
+// and missing ones are left empty, so files from older (or newer) versions
+// can still be read.
+func ReadTSVParseData(r io.Reader) ([]*PerfData, os.Error) {
+	table, err := ReadTable(r)
+	if err != nil {
+		return nil, err
 	}
+	return tableParseData(table)
+}
+
+// Read a CSV file of results from disk into a set of PerfData
+func ReadTSVParseDataFile(filename string) ([]*PerfData, os.Error) {
+	table, err := ReadTableFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := tableParseData(table)
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("Error reading %s: %s", filename, err.String()))
+	}
+	return data, nil
+}
+
+// Fill in a PerfData from each row of a table of results
+func tableParseData(table *Table) ([]*PerfData, os.Error) {
+	columns := make([]string, 0, len(fieldNames))
+	for _, field := range fieldNames {
+		if table.Has(field) {
+			columns = append(columns, field)
+		}
+	}
+
+	data := make([]*PerfData, 0, len(table.Rows))
+
+	for idx, row := range table.Rows {
+		perfdata := new(PerfData)
+
+		// Turn the struct into a Type so we can use reflection
+		ptr, ok := reflect.NewValue(perfdata).(*reflect.PtrValue)
+		if !ok {
+			return nil, os.NewError("Could not convert results into a pointer value")
+		}
 
-	if total >= threshold {
-		return true
+		val, ok := ptr.Elem().(*reflect.StructValue)
+		if !ok {
+			return nil, os.NewError("Failed when reflecting on struct")
+		}
+
+		for _, field := range columns {
+			if err := setField(val.FieldByName(field), table.String(row, field)); err != nil {
+				return nil, os.NewError(fmt.Sprintf("Row %d, column %s: %s", idx+1, field, err.String()))
+			}
+		}
+
+		data = append(data, perfdata)
+	}
+
+	return data, nil
+}
+
+// Set a field from its value as written by WriteTSVParseData. An empty value
+// leaves the field unset.
+func setField(column reflect.Value, value string) os.Error {
+	if value == "" {
+		return nil
+	}
+
+	switch column.(type) {
+	case *reflect.StringValue:
+		column.(*reflect.StringValue).Set(value)
+	case *reflect.FloatValue:
+		fvalue, err := strconv.Atof64(value)
+		if err != nil {
+			return err
+		}
+		column.(*reflect.FloatValue).Set(fvalue)
+	case *reflect.IntValue:
+		ivalue, err := strconv.Atoi64(value)
+		if err != nil {
+			return err
+		}
+		column.(*reflect.IntValue).Set(ivalue)
+	case *reflect.BoolValue:
+		bvalue, err := strconv.Atob(value)
+		if err != nil {
+			return err
+		}
+		column.(*reflect.BoolValue).Set(bvalue)
+	default:
+		return os.NewError("Got a field we cannot handle")
 	}
 
-	return false
+	return nil
 }
@@ -0,0 +1,62 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestReadTSVParseData(t *testing.T) {
+	written := []*PerfData{
+		&PerfData{BenchmarkId: "abc", BenchmarkDate: 1300000000, Phase: "ramp", Step: 3, Warmup: true,
+			ArgConnectionRate: 150, WorkerLabel: "w1", ConnectionsPerSecond: 149.5, ErrTotal: 2},
+		&PerfData{BenchmarkId: "abc", Phase: "ramp", Step: 3, ReplyTimeResponse: 1e6, NetIOUnit: "KB/s"},
+	}
+
+	buf := new(bytes.Buffer)
+	WriteTSVHeader(buf)
+	WriteTSVParseDataSet(buf, written)
+
+	data, err := ReadTSVParseData(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.String())
+	}
+	if len(data) != len(written) {
+		t.Fatalf("Expected %d rows, got %d", len(written), len(data))
+	}
+
+	first := data[0]
+	if first.BenchmarkId != "abc" || first.BenchmarkDate != 1300000000 || first.Phase != "ramp" ||
+		first.Step != 3 || !first.Warmup || first.ArgConnectionRate != 150 || first.WorkerLabel != "w1" ||
+		first.ConnectionsPerSecond != 149.5 || first.ErrTotal != 2 {
+		t.Errorf("First row did not survive the round trip: %#v", first)
+	}
+
+	second := data[1]
+	if second.Warmup || second.ReplyTimeResponse != 1e6 || second.NetIOUnit != "KB/s" {
+		t.Errorf("Second row did not survive the round trip: %#v", second)
+	}
+}
+
+// Files from other versions may lack some columns and have others we don't
+// know about.
+func TestReadTSVParseDataColumns(t *testing.T) {
+	input := "BenchmarkId,SomethingNew,ArgConnectionRate,ConnectionsPerSecond\nabc,xyz,100,98.5\n"
+
+	data, err := ReadTSVParseData(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.String())
+	}
+	if len(data) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(data))
+	}
+
+	if data[0].BenchmarkId != "abc" || data[0].ArgConnectionRate != 100 || data[0].ConnectionsPerSecond != 98.5 {
+		t.Errorf("Unexpected row %#v", data[0])
+	}
+	if data[0].Phase != "" || data[0].ErrTotal != 0 {
+		t.Errorf("Missing columns should be left empty: %#v", data[0])
+	}
+
+	if _, err := ReadTSVParseData(strings.NewReader("BenchmarkId,ArgPort\nabc,eighty\n")); err == nil {
+		t.Errorf("Expected an error reading an invalid number")
+	}
+}
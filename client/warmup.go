@@ -0,0 +1,62 @@
+package main
+
+import "log"
+
+// Warm up the server before the measured part of a phase, so that caches,
+// connection pools and the like are not cold for the first step. The results
+// are logged, and written with the Warmup column set if requested, but are
+// never returned to the phase, so they take no part in its stop criteria or
+// aggregates. A phase with several targets warms up each of them, and a
+// closed-loop phase is warmed up closed-loop, with the rate as the number of
+// clients.
+func RunWarmup(workers []*Worker, phase *Phase) {
+	closedLoop := (phase.Mode == "manual" && phase.Concurrency > 0) ||
+		(phase.Mode == "stressconn" && phase.StepConcurrency)
+
+	rate := phase.WarmupRate
+	if rate == 0 {
+		switch {
+		case phase.Mode == "manual" && closedLoop:
+			rate = phase.Concurrency
+		case phase.Mode == "manual" || phase.Mode == "soak" || phase.Mode == "spike":
+			rate = phase.Rate
+		case phase.Mode == "sweep":
+			rate = phase.sweep[0].Rate
+		default:
+			rate = phase.StartRate
+		}
+	}
+
+	// Each target is warmed up in turn, so that none of them starts cold
+	for _, tp := range phase.TargetPhases() {
+		args := tp.NewArgs(rate*phase.Warmup, rate)
+		args.Duration = phase.Warmup
+		if closedLoop {
+			log.Printf("Warming up %s with %d clients for %d seconds", tp.Title(), rate, phase.Warmup)
+			args.NumConnections = 0
+			args.ConnectionRate = 0
+			args.Concurrency = rate
+			args.Timeout = *timeout
+		} else {
+			log.Printf("Warming up %s at rate %d for %d seconds", tp.Title(), rate, phase.Warmup)
+		}
+		coordinator.SetStep(tp, 0, rate)
+
+		data, ok := RunDistributedBenchmark(workers, args)
+		if !ok {
+			log.Printf("Warmup did not fully succeed")
+		}
+
+		for _, perfdata := range data {
+			perfdata.Warmup = true
+		}
+		tp.Tag(data, 0)
+
+		if *writeWarmup {
+			WriteResults(data)
+		}
+	}
+
+	log.Printf("Finished warming up")
+	phase.Pause()
+}
@@ -0,0 +1,382 @@
+package main
+
+import "bufio"
+import "bytes"
+import "fmt"
+import "http"
+import "io"
+import "math"
+import "net"
+import "os"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+
+// How often the reply rate is sampled, as httperf does, in nanoseconds
+const replySampleInterval = 5 * 1000000000
+
+// How long a client waits after a failed connection before trying again, in
+// nanoseconds. The wait doubles with each failure in a row, up to the maximum.
+const dialBackoffMin = 10 * 1000000
+const dialBackoffMax = 1000000000
+
+// The results of a closed-loop benchmark, gathered by each client and then
+// merged. Times are in nanoseconds.
+type nativeStats struct {
+	connections, requests, replies int
+	connTimes                      []int64
+	connectTime                    int64
+	responseTime, transferTime     int64
+	requestBytes                   int64
+	headerBytes, contentBytes      int64
+	status                         [6]int
+	replyTimes                     []int64 // When each reply completed
+
+	clientTimeout, connRefused, connReset int
+	fdUnavail, addrUnavail, other         int
+}
+
+func (s *nativeStats) merge(o *nativeStats) {
+	s.connections += o.connections
+	s.requests += o.requests
+	s.replies += o.replies
+	s.connTimes = append(s.connTimes, o.connTimes...)
+	s.connectTime += o.connectTime
+	s.responseTime += o.responseTime
+	s.transferTime += o.transferTime
+	s.requestBytes += o.requestBytes
+	s.headerBytes += o.headerBytes
+	s.contentBytes += o.contentBytes
+	for idx := range s.status {
+		s.status[idx] += o.status[idx]
+	}
+	s.replyTimes = append(s.replyTimes, o.replyTimes...)
+	s.clientTimeout += o.clientTimeout
+	s.connRefused += o.connRefused
+	s.connReset += o.connReset
+	s.fdUnavail += o.fdUnavail
+	s.addrUnavail += o.addrUnavail
+	s.other += o.other
+}
+
+func (s *nativeStats) errors() int {
+	return s.clientTimeout + s.connRefused + s.connReset + s.fdUnavail + s.addrUnavail + s.other
+}
+
+// Classify a network error into one of the httperf error categories
+func (s *nativeStats) recordError(err os.Error) {
+	msg := err.String()
+	switch {
+	case strings.Index(msg, "timeout") >= 0 || strings.Index(msg, "timed out") >= 0,
+		strings.Index(msg, "resource temporarily unavailable") >= 0:
+		s.clientTimeout++
+	case strings.Index(msg, "connection refused") >= 0:
+		s.connRefused++
+	case strings.Index(msg, "connection reset") >= 0 || msg == "EOF":
+		s.connReset++
+	case strings.Index(msg, "too many open files") >= 0:
+		s.fdUnavail++
+	case strings.Index(msg, "cannot assign requested address") >= 0:
+		s.addrUnavail++
+	default:
+		s.other++
+	}
+}
+
+// Counts the bytes read from a connection, so the size of the reply headers
+// can be worked out from the total and the size of the body.
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err os.Error) {
+	n, err = c.r.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// The state shared by every client of a closed-loop benchmark
+type closedLoop struct {
+	args     *Args
+	addr     string
+	deadline int64 // Stop starting connections after this time, or 0
+
+	lock      sync.Mutex
+	remaining int // The number of connections left to start
+}
+
+// Whether another connection should be started: the deadline, if there is
+// one, has not passed, and the number of connections, if there is one, has
+// not been reached
+func (c *closedLoop) next() bool {
+	if c.deadline > 0 {
+		if time.Nanoseconds() >= c.deadline {
+			return false
+		}
+		if c.args.NumConnections <= 0 {
+			return true
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.remaining <= 0 {
+		return false
+	}
+	c.remaining--
+	return true
+}
+
+// The URI for the n'th request of a client, replaying the work log if given
+func (c *closedLoop) uri(n int) string {
+	if len(c.args.WorkLog) > 0 {
+		return c.args.WorkLog[n%len(c.args.WorkLog)]
+	}
+	return c.args.URL
+}
+
+// A single client of the closed-loop benchmark. Each connection sends its
+// requests one after another, and as soon as it closes the next one is
+// opened, so the client always has exactly one connection busy.
+func (c *closedLoop) client(id int, results chan *nativeStats) {
+	stats := new(nativeStats)
+	timeout := int64(c.args.Timeout) * 1000000000
+	n := id
+	backoff := int64(dialBackoffMin)
+
+	for c.next() {
+		start := time.Nanoseconds()
+		conn, err := net.Dial("tcp", "", c.addr)
+		if err != nil {
+			// Don't hammer a server that is refusing connections
+			stats.recordError(err)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > dialBackoffMax {
+				backoff = dialBackoffMax
+			}
+			continue
+		}
+		backoff = dialBackoffMin
+
+		stats.connections++
+		stats.connectTime += time.Nanoseconds() - start
+		if timeout > 0 {
+			conn.SetTimeout(timeout)
+		}
+
+		counter := &countingReader{conn, 0}
+		reader := bufio.NewReader(counter)
+
+		for req := 0; req < c.args.RequestsPerConnection; req++ {
+			request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: autohttperf\r\n\r\n", c.uri(n), c.args.Host)
+			n++
+
+			sent := time.Nanoseconds()
+			if _, err := conn.Write([]byte(request)); err != nil {
+				stats.recordError(err)
+				break
+			}
+			stats.requests++
+			stats.requestBytes += int64(len(request))
+
+			// Requests aren't pipelined, so nothing past this reply can
+			// have been read ahead into the buffer
+			before := counter.count
+			resp, err := http.ReadResponse(reader, "GET")
+			if err != nil {
+				stats.recordError(err)
+				break
+			}
+			responded := time.Nanoseconds()
+
+			content, err := io.Copy(ioutilDiscard{}, resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				stats.recordError(err)
+				break
+			}
+			done := time.Nanoseconds()
+
+			stats.replies++
+			stats.responseTime += responded - sent
+			stats.transferTime += done - responded
+			stats.contentBytes += content
+			stats.headerBytes += counter.count - before - content
+			stats.replyTimes = append(stats.replyTimes, done)
+
+			if class := resp.StatusCode / 100; class >= 1 && class <= 5 {
+				stats.status[class]++
+			}
+		}
+
+		conn.Close()
+		stats.connTimes = append(stats.connTimes, time.Nanoseconds()-start)
+	}
+
+	results <- stats
+}
+
+// Discards everything written to it
+type ioutilDiscard struct{}
+
+func (ioutilDiscard) Write(p []byte) (int, os.Error) { return len(p), nil }
+
+// Run a closed-loop benchmark with a fixed number of concurrent clients, for
+// the duration given in the arguments or until the requested number of
+// connections have been made. The report is written in the same format as
+// httperf, so the coordinator can parse it in the same way.
+func RunClosedLoop(args *Args) string {
+	loop := &closedLoop{
+		args:      args,
+		addr:      fmt.Sprintf("%s:%d", args.Host, args.Port),
+		remaining: args.NumConnections,
+	}
+
+	start := time.Nanoseconds()
+	if args.Duration > 0 {
+		loop.deadline = start + int64(args.Duration)*1000000000
+	}
+
+	results := make(chan *nativeStats)
+	for id := 0; id < args.Concurrency; id++ {
+		go loop.client(id, results)
+	}
+
+	stats := new(nativeStats)
+	for id := 0; id < args.Concurrency; id++ {
+		stats.merge(<-results)
+	}
+
+	elapsed := time.Nanoseconds() - start
+	return formatNativeReport(stats, args, start, elapsed)
+}
+
+type int64Slice []int64
+
+func (p int64Slice) Len() int           { return len(p) }
+func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Milliseconds from nanoseconds
+func ms(ns float64) float64 {
+	return ns / 1000000
+}
+
+// Write the results of a closed-loop benchmark in httperf's format
+func formatNativeReport(s *nativeStats, args *Args, start int64, elapsed int64) string {
+	seconds := float64(elapsed) / 1000000000
+	if seconds <= 0 {
+		seconds = 1
+	}
+
+	// Connection time distribution
+	var connMin, connAvg, connMax, connMedian, connStddev float64
+	if len(s.connTimes) > 0 {
+		sort.Sort(int64Slice(s.connTimes))
+		connMin = ms(float64(s.connTimes[0]))
+		connMax = ms(float64(s.connTimes[len(s.connTimes)-1]))
+		connMedian = ms(float64(s.connTimes[len(s.connTimes)/2]))
+
+		sum := 0.0
+		for _, t := range s.connTimes {
+			sum += ms(float64(t))
+		}
+		connAvg = sum / float64(len(s.connTimes))
+
+		squares := 0.0
+		for _, t := range s.connTimes {
+			squares += (ms(float64(t)) - connAvg) * (ms(float64(t)) - connAvg)
+		}
+		if len(s.connTimes) > 1 {
+			connStddev = math.Sqrt(squares / float64(len(s.connTimes)-1))
+		}
+	}
+
+	// Reply rate, sampled every five seconds
+	var rateMin, rateAvg, rateMax, rateStddev float64
+	numSamples := int(elapsed / replySampleInterval)
+	if numSamples > 0 {
+		buckets := make([]float64, numSamples)
+		for _, t := range s.replyTimes {
+			if bucket := int((t - start) / replySampleInterval); bucket < numSamples {
+				buckets[bucket]++
+			}
+		}
+
+		rateMin = math.MaxFloat64
+		sum := 0.0
+		for idx := range buckets {
+			buckets[idx] /= float64(replySampleInterval) / 1000000000
+			sum += buckets[idx]
+			rateMin = math.Fmin(rateMin, buckets[idx])
+			rateMax = math.Fmax(rateMax, buckets[idx])
+		}
+		rateAvg = sum / float64(numSamples)
+
+		squares := 0.0
+		for _, rate := range buckets {
+			squares += (rate - rateAvg) * (rate - rateAvg)
+		}
+		if numSamples > 1 {
+			rateStddev = math.Sqrt(squares / float64(numSamples-1))
+		}
+	}
+
+	perConn := func(v float64) float64 {
+		if s.connections == 0 {
+			return 0
+		}
+		return v / float64(s.connections)
+	}
+	perReply := func(v float64) float64 {
+		if s.replies == 0 {
+			return 0
+		}
+		return v / float64(s.replies)
+	}
+	perSecond := func(v float64) float64 {
+		if v == 0 {
+			return 0
+		}
+		return 1000 / v
+	}
+
+	connRate := float64(s.connections) / seconds
+	reqRate := float64(s.requests) / seconds
+	bytesPerSec := float64(s.requestBytes+s.headerBytes+s.contentBytes) / seconds
+
+	header := perReply(float64(s.headerBytes))
+	content := perReply(float64(s.contentBytes))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Maximum connect burst length: %d\n\n", args.Concurrency)
+	fmt.Fprintf(buf, "Total: connections %d requests %d replies %d test-duration %.3f s\n\n",
+		s.connections, s.requests, s.replies, seconds)
+	fmt.Fprintf(buf, "Connection rate: %.1f conn/s (%.1f ms/conn, <=%d concurrent connections)\n",
+		connRate, perSecond(connRate), args.Concurrency)
+	fmt.Fprintf(buf, "Connection time [ms]: min %.1f avg %.1f max %.1f median %.1f stddev %.1f\n",
+		connMin, connAvg, connMax, connMedian, connStddev)
+	fmt.Fprintf(buf, "Connection time [ms]: connect %.1f\n", ms(perConn(float64(s.connectTime))))
+	fmt.Fprintf(buf, "Connection length [replies/conn]: %.3f\n\n", perConn(float64(s.replies)))
+	fmt.Fprintf(buf, "Request rate: %.1f req/s (%.1f ms/req)\n", reqRate, perSecond(reqRate))
+	fmt.Fprintf(buf, "Request size [B]: %.1f\n\n", float64(s.requestBytes)/math.Fmax(float64(s.requests), 1))
+	fmt.Fprintf(buf, "Reply rate [replies/s]: min %.1f avg %.1f max %.1f stddev %.1f (%d samples)\n",
+		rateMin, rateAvg, rateMax, rateStddev, numSamples)
+	fmt.Fprintf(buf, "Reply time [ms]: response %.1f transfer %.1f\n",
+		ms(perReply(float64(s.responseTime))), ms(perReply(float64(s.transferTime))))
+	fmt.Fprintf(buf, "Reply size [B]: header %.1f content %.1f footer 0.0 (total %.1f)\n",
+		header, content, header+content)
+	fmt.Fprintf(buf, "Reply status: 1xx=%d 2xx=%d 3xx=%d 4xx=%d 5xx=%d\n\n",
+		s.status[1], s.status[2], s.status[3], s.status[4], s.status[5])
+	fmt.Fprintf(buf, "CPU time [s]: user 0.00 system 0.00 (user 0.0%% system 0.0%% total 0.0%%)\n")
+	fmt.Fprintf(buf, "Net I/O: %.1f KB/s (%.1f*10^6 bps)\n\n", bytesPerSec/1024, bytesPerSec*8/1000000)
+	fmt.Fprintf(buf, "Errors: total %d client-timo %d socket-timo 0 connrefused %d connreset %d\n",
+		s.errors(), s.clientTimeout, s.connRefused, s.connReset)
+	fmt.Fprintf(buf, "Errors: fd-unavail %d addrunavail %d ftab-full 0 other %d\n",
+		s.fdUnavail, s.addrUnavail, s.other)
+
+	return buf.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import "io/ioutil"
+import "testing"
+
+// The results of a 10 second closed-loop benchmark: four connections, one of
+// which timed out after a single reply
+func testStats() *nativeStats {
+	return &nativeStats{
+		connections:   4,
+		requests:      8,
+		replies:       7,
+		connTimes:     []int64{1000000, 6000000, 2000000, 3000000},
+		connectTime:   400000,
+		responseTime:  14000000,
+		transferTime:  7000000,
+		requestBytes:  576,
+		headerBytes:   1190,
+		contentBytes:  28700,
+		status:        [6]int{0, 0, 6, 0, 0, 1},
+		replyTimes:    []int64{1000000000, 2000000000, 3000000000, 4000000000, 6000000000, 7000000000, 8000000000},
+		clientTimeout: 1,
+	}
+}
+
+// The report must match testdata/native_report.txt exactly, since the
+// client's tests parse that file with the pattern they use for httperf
+func TestFormatNativeReport(t *testing.T) {
+	expected, err := ioutil.ReadFile("testdata/native_report.txt")
+	if err != nil {
+		t.Fatalf("Could not read the expected report: %s", err.String())
+	}
+
+	report := formatNativeReport(testStats(), &Args{Concurrency: 4}, 0, 10*1000000000)
+	if report != string(expected) {
+		t.Errorf("Expected the report:\n%s\ngot:\n%s", expected, report)
+	}
+}
+
+func TestMergeNativeStats(t *testing.T) {
+	stats := testStats()
+	stats.merge(testStats())
+
+	if stats.connections != 8 || stats.replies != 14 || len(stats.connTimes) != 8 || len(stats.replyTimes) != 14 {
+		t.Errorf("Expected the counts and samples of both to be kept, got %v", stats)
+	}
+	if stats.status[2] != 12 || stats.errors() != 2 {
+		t.Errorf("Expected 12 2xx replies and 2 errors, got %d and %d", stats.status[2], stats.errors())
+	}
+}
@@ -9,6 +9,7 @@ import "log"
 import "net"
 import "os"
 import "rpc"
+import "time"
 
 type Args struct {
 	Host                  string
@@ -18,12 +19,21 @@ type Args struct {
 	ConnectionRate        int
 	RequestsPerConnection int
 	Duration              int
+	WorkLog               []string // A sequence of URIs to replay instead of URL
+	Concurrency           int      // Clients to keep busy (closed loop), or 0 for httperf
+	Timeout               int      // Seconds a closed-loop client waits for a reply, 0 for no limit
 }
 
 type Result struct {
 	Stdout     string
 	Stderr     string
 	ExitStatus int
+	Started    int64 // Worker clock (ns) when the benchmark process started
+	Finished   int64 // Worker clock (ns) when the benchmark process exited
+}
+
+type Clock struct {
+	Nanoseconds int64
 }
 
 type HTTPerf int
@@ -35,9 +45,24 @@ const (
 	ERR_NOTEXITED    = "Command did not properly exit: %s"
 	ERR_READOUT      = "Could not read stdout: %s"
 	ERR_READERR      = "Could not read stderr: %s"
+	ERR_WORKLOG      = "Could not write the work log: %s"
 )
 
 func (h *HTTPerf) Benchmark(args *Args, result *Result) os.Error {
+	// A closed-loop benchmark is run natively rather than by httperf, which
+	// can only open connections at a fixed rate.
+	if args.Concurrency > 0 {
+		log.Printf("++ [%p] Running closed-loop benchmark of %s on port %d", args, args.Host, args.Port)
+		log.Printf("   [%p] Input arguments: %#v", args, args)
+
+		result.Started = time.Nanoseconds()
+		result.Stdout = RunClosedLoop(args)
+		result.Finished = time.Nanoseconds()
+
+		log.Printf("-- [%p] Closed-loop benchmark finished", args)
+		return nil
+	}
+
 	// Try to find the 'httpperf' command, which must exist in the PATH
 	// of the current user/environment.
 
@@ -46,22 +71,37 @@ func (h *HTTPerf) Benchmark(args *Args, result *Result) os.Error {
 		return os.NewError(fmt.Sprintf(ERR_EXECNOTFOUND, err.String()))
 	}
 
+	// Either request a single URI, or replay the work log in a loop
+	target := []string{"--uri", args.URL}
+	if len(args.WorkLog) > 0 {
+		wlog, err := writeWorkLog(args.WorkLog)
+		if err != nil {
+			return os.NewError(fmt.Sprintf(ERR_WORKLOG, err.String()))
+		}
+		defer os.Remove(wlog)
+
+		target = []string{"--wlog", "y," + wlog}
+	}
+
 	// Build the httperf commandline and build a result to return
 	argv := []string{
 		perfexec,
 		"--server", args.Host,
 		"--port", fmt.Sprintf("%d", args.Port),
-		"--uri", args.URL,
+	}
+	argv = append(argv, target...)
+	argv = append(argv,
 		"--num-conns", fmt.Sprintf("%d", args.NumConnections),
 		"--rate", fmt.Sprintf("%d", args.ConnectionRate),
 		"--num-calls", fmt.Sprintf("%d", args.RequestsPerConnection),
 		"--hog",
-	}
+	)
 
 	log.Printf("++ [%p] Running benchmark of %s on port %d", args, args.Host, args.Port)
 	log.Printf("   [%p] Input arguments: %#v", args, args)
 	log.Printf("   [%p] Commandline arguments: %#v", args, argv)
 
+	result.Started = time.Nanoseconds()
 	cmd, err := exec.Run(argv[0], argv, nil, "", exec.DevNull, exec.Pipe, exec.Pipe)
 	if err != nil {
 		return os.NewError(fmt.Sprintf(ERR_RUNFAILED, err.String()))
@@ -83,6 +123,7 @@ func (h *HTTPerf) Benchmark(args *Args, result *Result) os.Error {
 	log.Printf("   [%p] Finished reading stdout and stderr", args)
 
 	w, err := cmd.Wait(0)
+	result.Finished = time.Nanoseconds()
 
 	log.Printf("-- [%p] Command joined and finished", args)
 
@@ -99,6 +140,33 @@ func (h *HTTPerf) Benchmark(args *Args, result *Result) os.Error {
 	return nil
 }
 
+// Write a sequence of URIs to a temporary file in the format expected by the
+// httperf --wlog option, i.e. separated by NUL characters. Returns the name of
+// the file, which the caller must remove.
+func writeWorkLog(uris []string) (string, os.Error) {
+	file, err := ioutil.TempFile("", "autohttperf-wlog")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	for _, uri := range uris {
+		if _, err := file.Write([]byte(uri + "\x00")); err != nil {
+			os.Remove(file.Name())
+			return "", err
+		}
+	}
+
+	return file.Name(), nil
+}
+
+// Reports the current time on the worker so the coordinator can estimate the
+// offset between its clock and ours. The argument is unused.
+func (h *HTTPerf) Time(args *Clock, reply *Clock) os.Error {
+	reply.Nanoseconds = time.Nanoseconds()
+	return nil
+}
+
 var host *string = flag.String("host", "", "The host on which to bind the server")
 var port *int = flag.Int("port", 1717, "The port on which to bind the server")
 